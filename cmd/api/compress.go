@@ -0,0 +1,215 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// defaultCompressionExemptTypes lists the content types which are already
+// compressed, or which are streamed to the client and shouldn't be held back
+// in a buffer. A trailing "/" matches every subtype.
+var defaultCompressionExemptTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-ndjson",
+	"text/event-stream",
+}
+
+// negotiateEncoding picks the content coding to use from the request's
+// Accept-Encoding header, preferring brotli over gzip when the client names
+// both and rates them equally. A wildcard only covers the codings the client
+// didn't name, and on its own picks gzip, the most widely supported one. It
+// returns "" if the response should be sent uncompressed.
+func negotiateEncoding(acceptEncoding string) string {
+	named := make(map[string]float64)
+	wildcard := 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = v
+		}
+
+		if coding == "*" {
+			wildcard = q
+			continue
+		}
+		named[coding] = q
+	}
+
+	brQ, brNamed := named["br"]
+	if !brNamed {
+		brQ = wildcard
+	}
+	gzipQ, gzipNamed := named["gzip"]
+	if !gzipNamed {
+		gzipQ = wildcard
+	}
+
+	switch {
+	case brQ > 0 && (brQ > gzipQ || (brQ == gzipQ && brNamed)):
+		return "br"
+	case gzipQ > 0:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressResponseWriter holds back the start of the response until it has at
+// least minSize bytes, then decides whether it's worth compressing. Responses
+// which finish before reaching minSize are sent as they are.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	exempt   []string
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (cw *compressResponseWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressResponseWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends whatever has been written so far. Handlers that stream their
+// output call this, so we have to make the compression decision early.
+func (cw *compressResponseWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(len(cw.buf) >= cw.minSize); err != nil {
+			return
+		}
+	}
+
+	switch enc := cw.enc.(type) {
+	case *gzip.Writer:
+		enc.Flush()
+	case *brotli.Writer:
+		enc.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide writes the headers, using compression if the response is large
+// enough and of a suitable type, followed by anything buffered so far.
+func (cw *compressResponseWriter) decide(largeEnough bool) error {
+	cw.decided = true
+	h := cw.Header()
+
+	// If the handler didn't set a Content-Type, net/http would sniff one
+	// from the body. Do the same now so the exemption list can see it.
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if largeEnough && cw.compressible() {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		switch cw.encoding {
+		case "br":
+			cw.enc = brotli.NewWriterLevel(cw.ResponseWriter, brotli.DefaultCompression)
+		default:
+			cw.enc = gzip.NewWriter(cw.ResponseWriter)
+		}
+	}
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+func (cw *compressResponseWriter) compressible() bool {
+	switch cw.status {
+	case http.StatusNoContent, http.StatusNotModified:
+		return false
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	for _, exempt := range cw.exempt {
+		if strings.HasSuffix(exempt, "/") && strings.HasPrefix(contentType, exempt) {
+			return false
+		}
+		if contentType == exempt || strings.HasPrefix(contentType, exempt+";") {
+			return false
+		}
+	}
+	return true
+}
+
+// close sends anything still buffered and finishes the compressed stream.
+func (cw *compressResponseWriter) close() error {
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.enc != nil {
+		return cw.enc.Close()
+	}
+	return nil
+}
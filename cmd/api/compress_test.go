@@ -0,0 +1,96 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=0.8, gzip;q=0.8", "br"},
+		{"GZIP", "gzip"},
+		{"gzip;q=0", ""},
+		{"gzip;q=nope", ""},
+		{"*", "gzip"},
+		{"*;q=0", ""},
+		{"br, *", "br"},
+		{"gzip;q=0, *", "br"},
+		{"gzip;q=0, br;q=0, *", ""},
+		{"*, gzip;q=0", "br"},
+		{"gzip;q=0.5, *", "br"},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.acceptEncoding); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q; want %q", tt.acceptEncoding, got, tt.want)
+		}
+	}
+}
+
+func TestCompressResponse(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.compression.enabled = true
+	app.config.compression.minSize = 100
+	app.config.compression.exemptTypes = defaultCompressionExemptTypes
+
+	large := strings.Repeat("greenlight ", 50)
+
+	tests := []struct {
+		name         string
+		contentType  string
+		body         string
+		wantEncoding string
+	}{
+		{"large", "application/json", large, "gzip"},
+		{"below min size", "application/json", "{}", ""},
+		{"exempt type", "image/png", large, ""},
+		{"exempt type with parameters", "application/x-ndjson; charset=utf-8", large, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := app.compressResponse(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, tt.body)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if got := rr.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("got Content-Encoding %q; want %q", got, tt.wantEncoding)
+			}
+
+			body := io.Reader(rr.Body)
+			if tt.wantEncoding == "gzip" {
+				zr, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.body {
+				t.Errorf("got body %q; want %q", got, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+)
+
+// Define a custom contextKey type, with the underlying type string, so that
+// our keys can't collide with keys set by other packages.
+type contextKey string
+
+const (
+	userContextKey      = contextKey("user")
+	requestIDContextKey = contextKey("request_id")
+	loggerContextKey    = contextKey("logger")
+)
+
+// contextSetUser returns a new copy of the request with the provided User
+// struct added to the context.
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser retrieves the User struct from the request context, or nil
+// if the request hasn't been authenticated.
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// contextSetRequestID returns a new copy of the request with its ID added to
+// the context.
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID retrieves the request's ID from the context, or an
+// empty string if it hasn't got one.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// contextSetLogger returns a new copy of the request with a logger for it
+// added to the context.
+func (app *application) contextSetLogger(r *http.Request, logger *greenlog.Greenlog) *http.Request {
+	ctx := context.WithValue(r.Context(), loggerContextKey, logger)
+	return r.WithContext(ctx)
+}
+
+// contextGetLogger retrieves the request's logger, which tags entries with
+// the request ID and user ID, or the application's logger if the request
+// hasn't got one.
+func (app *application) contextGetLogger(r *http.Request) *greenlog.Greenlog {
+	logger, ok := r.Context().Value(loggerContextKey).(*greenlog.Greenlog)
+	if !ok {
+		return app.logger
+	}
+	return logger
+}
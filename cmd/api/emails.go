@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+	"github.com/jahidhimon/greenlight.git/internal/i18n"
+	"github.com/jahidhimon/greenlight.git/internal/mailer"
+	"github.com/jahidhimon/greenlight.git/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// emailPreviewData returns made-up data for each email template, of the same
+// type the template is sent with, for previewing it.
+func emailPreviewData() map[string]interface{} {
+	return map[string]interface{}{
+		"user_welcome.tmpl": &data.User{
+			ID:        123,
+			CreatedAt: time.Now(),
+			Name:      "Alice Example",
+			Email:     "alice@example.com",
+		},
+	}
+}
+
+// previewEmailHandler renders an email template with sample data, so that it
+// can be checked without sending it. The template can be named with or
+// without its .tmpl extension, and ?locale picks the translation to preview,
+// defaulting to the locale of the request. By default the subject and both
+// bodies are returned as JSON; ?format=html or ?format=text returns just that
+// body, ready to open in a browser.
+func (app *application) previewEmailHandler(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("template")
+	if !strings.HasSuffix(name, ".tmpl") {
+		name += ".tmpl"
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	format := app.readString(qs, "format", "json")
+	v.Check(validator.In(format, "json", "html", "text"), "format", "must be json, html or text")
+
+	locale := app.readString(qs, "locale", app.requestLocale(r))
+	v.Check(i18n.IsSupported(locale), "locale", "must be a supported locale")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	sample, ok := emailPreviewData()[name]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	msg, err := app.currentMailer().Render(locale, name, sample)
+	if err != nil {
+		switch {
+		case errors.Is(err, mailer.ErrTemplateNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	switch format {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(msg.HTMLBody))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(msg.PlainBody))
+	default:
+		preview := map[string]string{
+			"template":   name,
+			"locale":     locale,
+			"subject":    msg.Subject,
+			"plain_body": msg.PlainBody,
+			"html_body":  msg.HTMLBody,
+		}
+		err = app.writeJSON(w, http.StatusOK, envelope{"email": preview}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jahidhimon/greenlight.git/internal/i18n"
+)
+
+func TestPreviewEmailHandler(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	token := ts.registerAdmin(t, "Admin", "admin@example.com", "pa55word1234")
+	ts.registerUser(t, "Alice", "alice@example.com", "pa55word1234")
+	userToken := ts.authenticate(t, "alice@example.com", "pa55word1234")
+
+	ts.request(t, http.MethodGet, "/v1/admin/emails/user_welcome/preview").withToken(userToken).do().
+		expectStatus(http.StatusForbidden)
+
+	var env struct {
+		Email map[string]string `json:"email"`
+	}
+	ts.request(t, http.MethodGet, "/v1/admin/emails/user_welcome/preview").withToken(token).do().
+		expectStatus(http.StatusOK).decode(&env)
+	if env.Email["template"] != "user_welcome.tmpl" || env.Email["subject"] != "Welcome to Greenlight!" {
+		t.Errorf("got %v", env.Email)
+	}
+	if !strings.Contains(env.Email["plain_body"], "123") || !strings.Contains(env.Email["html_body"], "<html>") {
+		t.Errorf("bodies weren't rendered with the sample data: %v", env.Email)
+	}
+
+	res := ts.request(t, http.MethodGet, "/v1/admin/emails/user_welcome.tmpl/preview?format=html").withToken(token).do().
+		expectStatus(http.StatusOK).
+		expectHeader("Content-Type", "text/html; charset=utf-8")
+	if !strings.Contains(string(res.body), "user ID number is 123") {
+		t.Errorf("got body %s", res.body)
+	}
+
+	ts.request(t, http.MethodGet, "/v1/admin/emails/user_welcome/preview?format=pdf").withToken(token).do().
+		expectStatus(http.StatusUnprocessableEntity).expectErrorKeys("format")
+	ts.request(t, http.MethodGet, "/v1/admin/emails/user_welcome/preview?locale=es").withToken(token).do().
+		expectStatus(http.StatusOK).decode(&env)
+	if env.Email["locale"] != "es" || env.Email["subject"] != "¡Bienvenido a Greenlight!" {
+		t.Errorf("got %v", env.Email)
+	}
+	ts.request(t, http.MethodGet, "/v1/admin/emails/user_welcome/preview?locale=xx").withToken(token).do().
+		expectStatus(http.StatusUnprocessableEntity).expectErrorKeys("locale")
+	ts.request(t, http.MethodGet, "/v1/admin/emails/missing/preview").withToken(token).do().
+		expectStatus(http.StatusNotFound)
+}
+
+// Every template needs sample data, or it can't be previewed.
+func TestEmailPreviewData(t *testing.T) {
+	app := newTestApplication(t)
+	samples := emailPreviewData()
+
+	for _, name := range app.mailer.Templates() {
+		sample, ok := samples[name]
+		if !ok {
+			t.Errorf("no preview data for %s", name)
+			continue
+		}
+		for _, locale := range append(app.mailer.Locales(name), i18n.Default) {
+			if _, err := app.mailer.Render(locale, name, sample); err != nil {
+				t.Errorf("rendering %s in %s: %v", name, locale, err)
+			}
+		}
+	}
+}
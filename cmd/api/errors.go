@@ -3,25 +3,28 @@ package main
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+	"github.com/jahidhimon/greenlight.git/internal/i18n"
+	"github.com/jahidhimon/greenlight.git/internal/validator"
 )
 
 func (app *application) badRequestResponse(w http.ResponseWriter,
 	r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.writeError(w, r, http.StatusBadRequest, problemBadRequest, err.Error())
 }
 
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	app.writeError(w, r, http.StatusUnprocessableEntity, problemValidationFailed, v)
 }
 
-
-// Generic logger for this application.
-// TODO: Upgrade this to log request information including http method and URL
+// logError logs an error with the request's method and URL. The request's
+// logger adds its ID, and the user's ID if it was authenticated.
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintInfo(err.Error(), map[string]string{
-		"request_method": r.Method,
-		"request_url": r.URL.String(),
-	})
+	app.contextGetLogger(r).Error(err,
+		greenlog.String("request_method", r.Method),
+		greenlog.String("request_url", r.URL.String()),
+	)
 }
 
 // The errorResponse() method is a generic helper for sending JSON-formatteed error
@@ -30,9 +33,54 @@ func (app *application) logError(r *http.Request, err error) {
 // as it provides flexibility over the values that we can include in the response
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request,
 	status int, message interface{}) {
-	env := envelope{"error": message}
-	// Write and send the json to the client using writeJSON() helper and then log it
-	err := app.writeJSON(w, status, env, nil)
+	app.writeError(w, r, status, problemType{}, message)
+}
+
+// writeError sends an error response. kind says what sort of error it is in
+// problem+json responses, which are sent if the client asks for them or
+// -problem-details is set; other clients get the message in an "error"
+// member.
+//
+// A string message, or the messages in a map of validation errors or a
+// validator, are translated into the request's locale. Clients which don't
+// want problem+json get the first error for each field of a validator.
+func (app *application) writeError(w http.ResponseWriter, r *http.Request,
+	status int, kind problemType, message interface{}) {
+	locale := app.requestLocale(r)
+	switch m := message.(type) {
+	case string:
+		message = i18n.Translate(locale, m)
+	case map[string]string:
+		translated := make(map[string]string, len(m))
+		for key, msg := range m {
+			translated[key] = i18n.Translate(locale, msg)
+		}
+		message = translated
+	case *validator.Validator:
+		translated := validator.New()
+		for _, e := range m.Details {
+			translated.AddErrorCode(e.Key, e.Code, i18n.Translate(locale, e.Message))
+		}
+		message = translated
+	}
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+
+	var err error
+	if app.config.problemDetails {
+		err = app.writeProblem(w, r, status, kind, locale, message)
+	} else {
+		w.Header().Add("Vary", "Accept")
+		if wantsProblemJSON(r) {
+			err = app.writeProblem(w, r, status, kind, locale, message)
+		} else {
+			if v, ok := message.(*validator.Validator); ok {
+				message = v.Errors
+			}
+			err = app.writeJSON(w, status, envelope{"error": message}, nil)
+		}
+	}
+	// If the response couldn't be written, log it and fall back to a bare 500.
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -46,29 +94,60 @@ func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Reque
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.writeError(w, r, http.StatusInternalServerError, problemServerError, message)
 }
 
 // The notFoundResponse() method will be used to send a 404 not found status code
 // and JSON response to the client
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "The requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.writeError(w, r, http.StatusNotFound, problemNotFound, message)
 }
 
 // The methodNotAllowedResponse() method will be used to send a 404 not found status code
 // and JSON response to the client
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
-	message := fmt.Sprintf("The %s method is not supported for this resource\n", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	message := fmt.Sprintf(app.translate(r, "The %s method is not supported for this resource\n"), r.Method)
+	app.writeError(w, r, http.StatusMethodNotAllowed, problemMethodNotAllowed, message)
 }
 
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	app.writeError(w, r, http.StatusConflict, problemEditConflict, message)
 }
 
 func (app *application) rateLimitExcededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
-	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+	app.writeError(w, r, http.StatusTooManyRequests, problemRateLimited, message)
+}
+
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.writeError(w, r, http.StatusUnauthorized, problemInvalidCredentials, message)
+}
+
+// The WWW-Authenticate header tells the client to authenticate with a bearer
+// token.
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing authentication token"
+	app.writeError(w, r, http.StatusUnauthorized, problemInvalidToken, message)
+}
+
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "you must be authenticated to access this resource"
+	app.writeError(w, r, http.StatusUnauthorized, problemAuthenticationRequired, message)
+}
+
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.writeError(w, r, http.StatusForbidden, problemInactiveAccount, message)
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.writeError(w, r, http.StatusForbidden, problemNotPermitted, message)
 }
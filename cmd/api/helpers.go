@@ -53,7 +53,9 @@ func (app *application) writeJSON(w http.ResponseWriter, status int,
 		w.Header()[key] = value
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
 	
 	w.WriteHeader(status)
 
@@ -102,7 +104,7 @@ func (app *application) readJSON(w http.ResponseWriter,
 		// return a generic error message. There is an open issue reagarding this at
 		// http://github.com/golang/go/issues/25956
 		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("Re contains badly-formed JSON")
+			return errors.New("body contains badly-formed JSON")
 
 		// Likewise, catch any *json.UnmarshalTypeError erros. These occur when the
 		// JSON value is th ewrong type for the target destination. If the error
@@ -185,24 +187,8 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 	i, err := strconv.Atoi(s)
 	if err != nil {
-		v.AddError(key, "Must be an valid integer value")
+		v.AddError(key, "must be an integer value")
 		return defaultValue
 	}
 	return i
 }
-
-func (app *application)background(fn func()) {
-	app.wg.Add(1)
-	// Launch a background goroutine
-	go func () {
-		defer app.wg.Done()
-		
-		// Recover any panic.
-		defer func() {
-			if err := recover(); err != nil {
-				app.logger.PrintError(fmt.Errorf("%s", err), nil)
-			}
-		}()
-		fn()
-	}()
-}
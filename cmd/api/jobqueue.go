@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+	"github.com/jahidhimon/greenlight.git/internal/tracing"
+)
+
+const (
+	// jobLease is how long a worker has to finish a job before another
+	// worker may assume it died and take the job over. Jobs are given a
+	// context which ends when the lease does.
+	jobLease = 2 * time.Minute
+
+	// A job which fails waits jobBackoffBase before its second attempt,
+	// twice that before its third and so on, up to jobBackoffMax.
+	jobBackoffBase = 10 * time.Second
+	jobBackoffMax  = time.Hour
+)
+
+// Job kinds. Each one has a payload type and an entry in jobHandlers.
+const (
+	jobWelcomeEmail = "welcome_email"
+)
+
+type welcomeEmailPayload struct {
+	UserID int64  `json:"user_id"`
+	Locale string `json:"locale,omitempty"`
+}
+
+// jobHandlers returns the function which does the work for each kind of job.
+// A handler gets the job's raw payload; decodePayload turns it back into the
+// payload type.
+func (app *application) jobHandlers() map[string]func(ctx context.Context, payload json.RawMessage) error {
+	return map[string]func(ctx context.Context, payload json.RawMessage) error{
+		jobWelcomeEmail: app.sendWelcomeEmail,
+	}
+}
+
+func decodePayload(payload json.RawMessage, dst interface{}) error {
+	err := json.Unmarshal(payload, dst)
+	if err != nil {
+		return fmt.Errorf("decoding job payload: %w", err)
+	}
+	return nil
+}
+
+// enqueueJob adds a job to the queue using models, which may be bound to a
+// transaction so that the job is only queued if the rest of the transaction
+// is committed.
+func (app *application) enqueueJob(ctx context.Context, models data.Models, kind string, payload interface{}) error {
+	job, err := data.NewJob(kind, payload, app.config.jobs.maxAttempts)
+	if err != nil {
+		return err
+	}
+	// Running the job carries on the trace of the request which queued it.
+	if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+		job.Traceparent = sc.Traceparent()
+	}
+	return models.Jobs.Enqueue(ctx, job)
+}
+
+func (app *application) sendWelcomeEmail(ctx context.Context, payload json.RawMessage) error {
+	var p welcomeEmailPayload
+	if err := decodePayload(payload, &p); err != nil {
+		return err
+	}
+
+	user, err := app.models.Users.Get(ctx, p.UserID)
+	if err != nil {
+		// The user has been deleted since signing up, so there's no one
+		// to welcome.
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// The user's preference wins over the language they signed up in, in
+	// case they've changed it since.
+	locale := p.Locale
+	if user.Locale != "" {
+		locale = user.Locale
+	}
+
+	return app.currentMailer().SendContext(ctx, user.Email, locale, "user_welcome.tmpl", user)
+}
+
+// startJobWorkers starts the configured number of workers, which run jobs
+// until ctx is cancelled. Each worker finishes the job it is running before
+// stopping, and app.wg waits for them all.
+func (app *application) startJobWorkers(ctx context.Context) {
+	for i := 0; i < app.config.jobs.workers; i++ {
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+
+			for ctx.Err() == nil {
+				ran, err := app.runNextJob(ctx)
+				// Claim fails once ctx is cancelled at shutdown, which
+				// isn't worth an error.
+				if err != nil && ctx.Err() == nil {
+					app.logger.PrintError(err, nil)
+				}
+				if ran {
+					continue
+				}
+
+				select {
+				case <-ctx.Done():
+				case <-time.After(app.config.jobs.pollInterval):
+				}
+			}
+		}()
+	}
+}
+
+// runNextJob claims the next job which is due and runs it. It reports whether
+// there was a job to run, and returns an error if the queue itself failed;
+// errors from the job are recorded against the job.
+func (app *application) runNextJob(ctx context.Context) (bool, error) {
+	job, err := app.models.Jobs.Claim(ctx, jobLease)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// The job isn't cut short when ctx is cancelled at shutdown, only when
+	// the lease runs out.
+	jobCtx, cancel := context.WithTimeout(context.Background(), jobLease)
+	defer cancel()
+
+	if sc, err := tracing.ParseTraceparent(job.Traceparent); err == nil {
+		jobCtx = tracing.ContextWithRemoteSpanContext(jobCtx, sc)
+	}
+	jobCtx, span := tracing.Start(jobCtx, "job "+job.Kind, tracing.KindConsumer)
+	defer span.End()
+	span.SetAttributes(
+		tracing.Int64("job.id", job.ID),
+		tracing.String("job.kind", job.Kind),
+		tracing.Int("job.attempt", job.Attempts),
+	)
+
+	jobErr := app.runJob(jobCtx, job)
+	span.RecordError(jobErr)
+	if jobErr == nil {
+		return true, app.models.Jobs.Complete(jobCtx, job.ID)
+	}
+
+	err = app.models.Jobs.Fail(jobCtx, job, jobErr, time.Now().Add(jobBackoff(job.Attempts)))
+	if err != nil {
+		return true, err
+	}
+
+	app.logger.With(traceFields(jobCtx)...).Error(jobErr,
+		greenlog.Int64("job_id", job.ID),
+		greenlog.String("job_kind", job.Kind),
+		greenlog.Int("attempt", job.Attempts),
+		greenlog.Int("max_attempts", job.MaxAttempts),
+		greenlog.String("state", job.State),
+	)
+	return true, nil
+}
+
+// runJob calls the job's handler, turning a panic into an error.
+func (app *application) runJob(ctx context.Context, job *data.Job) (err error) {
+	handler, ok := app.jobHandlers()[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("job panicked: %v", v)
+		}
+	}()
+
+	return handler(ctx, job.Payload)
+}
+
+// jobBackoff returns how long to wait before the next attempt at a job which
+// has failed attempts times. Half the wait is random, so that jobs which
+// failed together don't all retry together.
+func jobBackoff(attempts int) time.Duration {
+	backoff := jobBackoffMax
+	if attempts < 30 {
+		backoff = jobBackoffBase << (attempts - 1)
+	}
+	if backoff > jobBackoffMax || backoff <= 0 {
+		backoff = jobBackoffMax
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)))
+}
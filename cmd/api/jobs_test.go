@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+)
+
+func TestWelcomeEmailJob(t *testing.T) {
+	app := newTestApplication(t)
+	capture := captureMail(t, app)
+	ts := newTestServer(t, app)
+	ctx := context.Background()
+
+	ts.registerUser(t, "Alice", "alice@example.com", "pa55word1234")
+
+	jobs, _, err := app.models.Jobs.GetAll(ctx, data.JobPending, data.Filters{Page: 1, PageSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Kind != jobWelcomeEmail {
+		t.Fatalf("got %d pending jobs; want one welcome email", len(jobs))
+	}
+	id := jobs[0].ID
+
+	// While the mail server is down each attempt fails and the job is put
+	// off until later.
+	capture.SetError(errors.New("connection refused"))
+	ran, err := app.runNextJob(ctx)
+	if err != nil || !ran {
+		t.Fatalf("runNextJob() = %v, %v; want true, nil", ran, err)
+	}
+
+	job, err := app.models.Jobs.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != data.JobPending || job.Attempts != 1 || job.LastError == "" {
+		t.Fatalf("got state %q, %d attempts, error %q; want a failed pending job", job.State, job.Attempts, job.LastError)
+	}
+
+	ran, err = app.runNextJob(ctx)
+	if err != nil || ran {
+		t.Fatalf("runNextJob() = %v, %v; want false, nil while the job backs off", ran, err)
+	}
+	if n := len(capture.Messages()); n != 0 {
+		t.Fatalf("got %d emails; want 0", n)
+	}
+}
+
+func TestWelcomeEmailJobSends(t *testing.T) {
+	app := newTestApplication(t)
+	capture := captureMail(t, app)
+	ts := newTestServer(t, app)
+	ctx := context.Background()
+
+	user := ts.registerUser(t, "Alice", "alice@example.com", "pa55word1234")
+
+	ran, err := app.runNextJob(ctx)
+	if err != nil || !ran {
+		t.Fatalf("runNextJob() = %v, %v; want true, nil", ran, err)
+	}
+
+	msgs := capture.Messages()
+	if len(msgs) != 1 || msgs[0].To != user.Email {
+		t.Fatalf("got %+v; want one email to %s", msgs, user.Email)
+	}
+
+	// The job is removed once it has been done.
+	jobs, _, err := app.models.Jobs.GetAll(ctx, "", data.Filters{Page: 1, PageSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("got %d jobs left; want 0", len(jobs))
+	}
+}
+
+func TestAdminJobHandlers(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.jobs.maxAttempts = 1
+	captureMail(t, app).SetError(errors.New("connection refused"))
+	ts := newTestServer(t, app)
+	ctx := context.Background()
+
+	token := ts.registerAdmin(t, "Admin", "admin@example.com", "pa55word1234")
+	ts.registerUser(t, "Alice", "alice@example.com", "pa55word1234")
+	userToken := ts.authenticate(t, "alice@example.com", "pa55word1234")
+
+	ts.request(t, http.MethodGet, "/v1/admin/jobs").do().
+		expectStatus(http.StatusUnauthorized)
+	ts.request(t, http.MethodGet, "/v1/admin/jobs").withToken(userToken).do().
+		expectStatus(http.StatusForbidden)
+
+	var list struct {
+		Jobs     []data.Job    `json:"jobs"`
+		Metadata data.Metadata `json:"metadata"`
+	}
+	ts.request(t, http.MethodGet, "/v1/admin/jobs?state=pending").withToken(token).do().
+		expectStatus(http.StatusOK).decode(&list)
+	if len(list.Jobs) != 2 {
+		t.Fatalf("got %d pending jobs; want 2", len(list.Jobs))
+	}
+	ts.request(t, http.MethodGet, "/v1/admin/jobs?state=lost").withToken(token).do().
+		expectStatus(http.StatusUnprocessableEntity).expectErrorKeys("state")
+
+	// With a single attempt allowed, the first failure kills the job.
+	id := list.Jobs[0].ID
+	path := "/v1/admin/jobs/" + strconv.FormatInt(id, 10)
+
+	ts.request(t, http.MethodPost, path+"/retry").withToken(token).do().
+		expectStatus(http.StatusConflict)
+
+	if _, err := app.runNextJob(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var show struct {
+		Job data.Job `json:"job"`
+	}
+	ts.request(t, http.MethodGet, path).withToken(token).do().
+		expectStatus(http.StatusOK).decode(&show)
+	if show.Job.State != data.JobDead {
+		t.Fatalf("got state %q; want %q", show.Job.State, data.JobDead)
+	}
+
+	ts.request(t, http.MethodPost, path+"/retry").withToken(token).do().
+		expectStatus(http.StatusOK).decode(&show)
+	if show.Job.State != data.JobPending || show.Job.Attempts != 0 {
+		t.Errorf("got state %q with %d attempts; want a fresh pending job", show.Job.State, show.Job.Attempts)
+	}
+
+	ts.request(t, http.MethodGet, "/v1/admin/jobs/999").withToken(token).do().
+		expectStatus(http.StatusNotFound)
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+	"golang.org/x/time/rate"
+)
+
+// limiterStore is the interface the rateLimit middleware uses to keep track of
+// each client's token bucket. Allow takes a token from the bucket for key,
+// which refills at rps tokens per second up to burst, and reports whether one
+// was available and how many are left. ctx is the request's context.
+type limiterStore interface {
+	Allow(ctx context.Context, key string, rps float64, burst int) (allowed bool, tokens float64, err error)
+}
+
+// memoryLimiterStore keeps the buckets in a map in this process. It's fast,
+// but when several API instances are running each one has its own budget.
+type memoryLimiterStore struct {
+	mu      sync.Mutex
+	clients map[string]*limiterClient
+}
+
+// minLimiterStaleAge is the shortest time a client's bucket is kept after its
+// last request.
+const minLimiterStaleAge = 3 * time.Minute
+
+type limiterClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newMemoryLimiterStore returns a memoryLimiterStore which forgets clients
+// that have been idle for longer than staleAge returns. staleAge is called
+// on each sweep so that it can follow the limiter settings through reloads.
+func newMemoryLimiterStore(staleAge func() time.Duration) *memoryLimiterStore {
+	s := &memoryLimiterStore{clients: make(map[string]*limiterClient)}
+
+	// Launch a background goroutine which removes old entries from the clients
+	// map once every minute
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			age := staleAge()
+			s.mu.Lock()
+			for key, client := range s.clients {
+				if time.Since(client.lastSeen) > age {
+					delete(s.clients, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}()
+
+	return s
+}
+
+func (s *memoryLimiterStore) Allow(ctx context.Context, key string, rps float64, burst int) (bool, float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check to see if the client already exists in the map
+	c, found := s.clients[key]
+	if !found {
+		c = &limiterClient{limiter: rate.NewLimiter(rate.Limit(rps), burst)}
+		s.clients[key] = c
+	}
+
+	// The limiter settings may have been changed by a SIGHUP reload since
+	// this client's limiter was created, so bring it up to date.
+	if c.limiter.Limit() != rate.Limit(rps) {
+		c.limiter.SetLimit(rate.Limit(rps))
+	}
+	if c.limiter.Burst() != burst {
+		c.limiter.SetBurst(burst)
+	}
+
+	c.lastSeen = time.Now()
+
+	allowed := c.limiter.Allow()
+	return allowed, c.limiter.Tokens(), nil
+}
+
+// postgresLimiterStore keeps the buckets in the rate_limits table, so the
+// limits are shared by every instance using the same database.
+type postgresLimiterStore struct {
+	data.RateLimitModel
+}
+
+func newPostgresLimiterStore(model data.RateLimitModel, logger *greenlog.Greenlog, staleAge func() time.Duration) *postgresLimiterStore {
+	// Clear out buckets which have been idle long enough to have refilled,
+	// matching the clean up the in-memory store does.
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			if err := model.DeleteStale(context.Background(), staleAge()); err != nil {
+				logger.PrintError(err, nil)
+			}
+		}
+	}()
+
+	return &postgresLimiterStore{model}
+}
+
+// newLimiterStore returns the store selected by the -limiter-store flag.
+// Buckets idle for longer than staleAge returns are removed.
+func newLimiterStore(name string, models data.Models, logger *greenlog.Greenlog, staleAge func() time.Duration) (limiterStore, error) {
+	switch name {
+	case "memory":
+		return newMemoryLimiterStore(staleAge), nil
+	case "postgres":
+		if models.RateLimits.DB == nil {
+			return nil, errors.New("the postgres limiter store needs the postgres data backend")
+		}
+		return newPostgresLimiterStore(models.RateLimits, logger, staleAge), nil
+	default:
+		return nil, fmt.Errorf("unknown limiter store %q", name)
+	}
+}
+
+// limiterTier holds the rate and burst for one class of client.
+type limiterTier struct {
+	rps   float64
+	burst int
+}
+
+// limiterConfig holds the rate limiter settings. The rps and burst fields are
+// the default tier, used for anonymous clients and for any tier that isn't
+// listed in tiers.
+type limiterConfig struct {
+	rps     float64
+	burst   int
+	enabled bool
+	// store is the name of the limiterStore implementation to use. It is
+	// fixed at startup and isn't changed by a reload.
+	store string
+	// tiers maps a tier name to its limits. The "user" tier applies to
+	// authenticated users, other tiers are assigned to API keys by apiKeys.
+	tiers   map[string]limiterTier
+	apiKeys map[string]string
+	// trustedProxies lists the networks whose X-Forwarded-For headers we
+	// believe when working out the client IP address.
+	trustedProxies []*net.IPNet
+}
+
+// tier returns the limits for the named tier, falling back to the defaults.
+func (lc limiterConfig) tier(name string) limiterTier {
+	if t, ok := lc.tiers[name]; ok {
+		return t
+	}
+	return limiterTier{rps: lc.rps, burst: lc.burst}
+}
+
+// staleAge returns how long a bucket has to go unused before it can be
+// forgotten without changing the outcome of the client's next request. That's
+// the time the slowest tier takes to refill a bucket from empty, and at least
+// minLimiterStaleAge.
+func (lc limiterConfig) staleAge() time.Duration {
+	age := minLimiterStaleAge
+	refill := func(t limiterTier) {
+		if t.rps <= 0 {
+			return
+		}
+		d := time.Duration(math.Ceil(float64(t.burst) / t.rps * float64(time.Second)))
+		if d > age {
+			age = d
+		}
+	}
+
+	refill(limiterTier{rps: lc.rps, burst: lc.burst})
+	for _, t := range lc.tiers {
+		refill(t)
+	}
+	return age
+}
+
+// limiterStaleAge returns how long the limiter stores keep an idle bucket for
+// the current limiter settings.
+func (app *application) limiterStaleAge() time.Duration {
+	return app.currentLimiterConfig().staleAge()
+}
+
+// parseLimiterTiers parses a space separated list of tiers in the format
+// "name=rps:burst", for example "user=5:10 partner=50:100".
+func parseLimiterTiers(s string) (map[string]limiterTier, error) {
+	tiers := make(map[string]limiterTier)
+	for _, field := range strings.Fields(s) {
+		name, limits, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid limiter tier %q", field)
+		}
+		rps, burst, ok := strings.Cut(limits, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid limiter tier %q", field)
+		}
+
+		var t limiterTier
+		var err error
+		t.rps, err = strconv.ParseFloat(rps, 64)
+		if err != nil || t.rps <= 0 {
+			return nil, fmt.Errorf("invalid rps in limiter tier %q", field)
+		}
+		t.burst, err = strconv.Atoi(burst)
+		if err != nil || t.burst < 1 {
+			return nil, fmt.Errorf("invalid burst in limiter tier %q", field)
+		}
+		tiers[name] = t
+	}
+	return tiers, nil
+}
+
+// formatLimiterTiers is the inverse of parseLimiterTiers. The tiers are sorted
+// by name so that the output is stable.
+func formatLimiterTiers(tiers map[string]limiterTier) string {
+	fields := make([]string, 0, len(tiers))
+	for name, t := range tiers {
+		fields = append(fields, fmt.Sprintf("%s=%s:%d", name,
+			strconv.FormatFloat(t.rps, 'g', -1, 64), t.burst))
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, " ")
+}
+
+// parseAPIKeys parses a space separated list of "key=tier" pairs.
+func parseAPIKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, field := range strings.Fields(s) {
+		key, tier, ok := strings.Cut(field, "=")
+		if !ok || key == "" || tier == "" {
+			return nil, fmt.Errorf("invalid limiter API key %q", field)
+		}
+		keys[key] = tier
+	}
+	return keys, nil
+}
+
+// parseTrustedProxies parses a list of IP addresses and CIDR ranges. A bare
+// address is treated as a single host network.
+func parseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", v)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", v)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func isTrustedProxy(ip net.IP, proxies []*net.IPNet) bool {
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of the client which made the request. If
+// the request came directly from one of the trusted proxies we walk the
+// X-Forwarded-For header from right to left and take the first address that
+// isn't another trusted proxy. Addresses to the left of that were supplied by
+// the client and can't be believed.
+func clientIP(r *http.Request, proxies []*net.IPNet) (string, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrustedProxy(ip, proxies) {
+		return host, nil
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hopIP := net.ParseIP(hops[i])
+		if hopIP == nil {
+			// A malformed entry means we can't trust anything further
+			// left, so count the request against the last good hop.
+			break
+		}
+		host = hopIP.String()
+		if !isTrustedProxy(hopIP, proxies) {
+			break
+		}
+	}
+
+	return host, nil
+}
+
+// rateLimitKey works out who a request should be counted against and which
+// tier of limits applies. A known API key in the X-API-Key header wins, then
+// the authenticated user, and finally the client IP address. Unknown API keys
+// are ignored, otherwise a client could reset its budget by making one up.
+func (app *application) rateLimitKey(r *http.Request, lc limiterConfig) (key string, tier limiterTier, err error) {
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		if name, ok := lc.apiKeys[apiKey]; ok {
+			return "key:" + apiKey, lc.tier(name), nil
+		}
+	}
+
+	if user := app.contextGetUser(r); user != nil {
+		return "user:" + strconv.FormatInt(user.ID, 10), lc.tier("user"), nil
+	}
+
+	return ipRateLimitKey(r, lc)
+}
+
+// ipRateLimitKey returns the key and tier for the client IP address.
+func ipRateLimitKey(r *http.Request, lc limiterConfig) (key string, tier limiterTier, err error) {
+	ip, err := clientIP(r, lc.trustedProxies)
+	if err != nil {
+		return "", limiterTier{}, err
+	}
+	return "ip:" + ip, lc.tier("anonymous"), nil
+}
+
+// setRateLimitHeaders adds the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers from the IETF RateLimit header fields draft. tokens
+// is the number of requests left in the client's bucket; Reset is the number
+// of seconds until the bucket is full again.
+func setRateLimitHeaders(w http.ResponseWriter, t limiterTier, tokens float64) {
+	remaining := math.Max(0, math.Floor(tokens))
+	reset := math.Ceil((float64(t.burst) - tokens) / t.rps)
+	if reset < 0 {
+		reset = 0
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(t.burst))
+	w.Header().Set("RateLimit-Remaining", strconv.FormatFloat(remaining, 'f', 0, 64))
+	w.Header().Set("RateLimit-Reset", strconv.FormatFloat(reset, 'f', 0, 64))
+}
+
+// retryAfter returns the number of whole seconds until a bucket holding tokens
+// will have one to spare.
+func retryAfter(t limiterTier, tokens float64) int {
+	wait := math.Ceil((1 - tokens) / t.rps)
+	if wait < 1 {
+		wait = 1
+	}
+	return int(wait)
+}
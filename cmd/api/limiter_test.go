@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterStaleAge(t *testing.T) {
+	tests := []struct {
+		name string
+		lc   limiterConfig
+		want time.Duration
+	}{
+		{
+			name: "fast tiers",
+			lc:   limiterConfig{rps: 2, burst: 4},
+			want: minLimiterStaleAge,
+		},
+		{
+			name: "slow default tier",
+			lc:   limiterConfig{rps: 0.01, burst: 5},
+			want: 500 * time.Second,
+		},
+		{
+			name: "slowest named tier",
+			lc: limiterConfig{rps: 2, burst: 4, tiers: map[string]limiterTier{
+				"user":    {rps: 0.1, burst: 30},
+				"partner": {rps: 0.5, burst: 600},
+			}},
+			want: 1200 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.lc.staleAge(); got != tt.want {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
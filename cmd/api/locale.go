@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/jahidhimon/greenlight.git/internal/i18n"
+)
+
+// requestLocale returns the locale to answer r in: the authenticated user's
+// stored preference if they have one, otherwise the best match for the
+// Accept-Language header.
+func (app *application) requestLocale(r *http.Request) string {
+	if user := app.contextGetUser(r); user != nil && user.Locale != "" {
+		return user.Locale
+	}
+	return i18n.Match(r.Header.Get("Accept-Language"))
+}
+
+// translate returns message in the locale for r.
+func (app *application) translate(r *http.Request, message string) string {
+	return i18n.Translate(app.requestLocale(r), message)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestLocalizedErrors(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	var env struct {
+		Error map[string]string `json:"error"`
+	}
+	ts.request(t, http.MethodPost, "/v1/users").
+		withHeader("Accept-Language", "es-MX, en;q=0.5").
+		withJSON(map[string]string{"name": "", "email": "alice@example.com", "password": "pa55word1234"}).do().
+		expectStatus(http.StatusUnprocessableEntity).
+		expectHeader("Content-Language", "es").
+		decode(&env)
+	if env.Error["name"] != "es obligatorio" {
+		t.Errorf("got name error %q", env.Error["name"])
+	}
+
+	var notFound struct {
+		Error string `json:"error"`
+	}
+	ts.request(t, http.MethodGet, "/v1/movies/999").withHeader("Accept-Language", "fr").do().
+		expectStatus(http.StatusNotFound).decode(&notFound)
+	if notFound.Error != "La ressource demandée est introuvable" {
+		t.Errorf("got %q", notFound.Error)
+	}
+
+	ts.request(t, http.MethodGet, "/v1/movies/999").withHeader("Accept-Language", "de").do().
+		expectStatus(http.StatusNotFound).
+		expectHeader("Content-Language", "en")
+
+	ts.request(t, http.MethodPost, "/v1/users").
+		withJSON(map[string]string{"name": "Bob", "email": "bob@example.com", "password": "pa55word1234", "locale": "xx"}).do().
+		expectStatus(http.StatusUnprocessableEntity).expectErrorKeys("locale")
+}
+
+// A user's stored locale wins over the Accept-Language header.
+func TestUserLocalePreference(t *testing.T) {
+	app := newTestApplication(t)
+	capture := captureMail(t, app)
+	ts := newTestServer(t, app)
+
+	input := map[string]string{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234", "locale": "fr"}
+	ts.request(t, http.MethodPost, "/v1/users").withHeader("Accept-Language", "es").withJSON(input).do().
+		expectStatus(http.StatusCreated)
+	token := ts.authenticate(t, "alice@example.com", "pa55word1234")
+
+	ts.request(t, http.MethodGet, "/v1/admin/jobs").withToken(token).withHeader("Accept-Language", "es").do().
+		expectStatus(http.StatusForbidden).
+		expectHeader("Content-Language", "fr")
+
+	if _, err := app.runNextJob(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := capture.Messages()
+	if len(msgs) != 1 || msgs[0].Subject != "Bienvenue sur Greenlight !" {
+		t.Fatalf("got %+v; want one welcome email in French", msgs)
+	}
+}
+
+// Without a stored locale, the welcome email is in the language the user
+// signed up in.
+func TestWelcomeEmailLocale(t *testing.T) {
+	app := newTestApplication(t)
+	capture := captureMail(t, app)
+	ts := newTestServer(t, app)
+
+	input := map[string]string{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234"}
+	ts.request(t, http.MethodPost, "/v1/users").withHeader("Accept-Language", "es").withJSON(input).do().
+		expectStatus(http.StatusCreated)
+
+	if _, err := app.runNextJob(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := capture.Messages()
+	if len(msgs) != 1 || msgs[0].Subject != "¡Bienvenido a Greenlight!" {
+		t.Fatalf("got %+v; want one welcome email in Spanish", msgs)
+	}
+}
@@ -3,14 +3,19 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/jahidhimon/greenlight.git/internal/data"
 	"github.com/jahidhimon/greenlight.git/internal/greenlog"
 	"github.com/jahidhimon/greenlight.git/internal/mailer"
+	"github.com/jahidhimon/greenlight.git/internal/tracing"
 
 	_ "github.com/lib/pq"
 )
@@ -20,18 +25,26 @@ const version = "0.0.1"
 
 // TODO: Define more configs
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port       int
+	env        string
+	configFile string
+	logLevel   string
+	logFormat  string
+	logStacks  string
+	db         struct {
 		dsn          string
+		replicaDSN   string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		migrate      bool
+		backend      string
+		timeouts     data.Timeouts
 	}
-	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+	limiter limiterConfig
+	mail    struct {
+		transport string
+		dir       string
 	}
 	smtp struct {
 		host     string
@@ -40,16 +53,64 @@ type config struct {
 		password string
 		sender   string
 	}
+	cors struct {
+		trustedOrigins []string
+	}
+	tls struct {
+		certFile     string
+		keyFile      string
+		redirectPort int
+	}
+	compression struct {
+		enabled     bool
+		minSize     int
+		exemptTypes []string
+	}
+	cache struct {
+		enabled bool
+		size    int
+		ttl     time.Duration
+	}
+	jobs struct {
+		workers      int
+		pollInterval time.Duration
+		maxAttempts  int
+	}
+	// problemDetails makes every error response RFC 7807 problem+json,
+	// rather than only those for clients which ask for it.
+	problemDetails bool
+	logFile        struct {
+		path       string
+		level      string
+		format     string
+		maxSize    int
+		rotate     time.Duration
+		maxBackups int
+		compress   bool
+	}
+	logSampling struct {
+		first      int
+		thereafter int
+	}
+	tracing struct {
+		exporter    string
+		file        string
+		sampleRatio float64
+	}
 }
 
 // application struct to hold the dependencies for our
-// HTTP handlers, helpers and middleware
+// HTTP handlers, helpers and middleware. The mu mutex guards the parts of
+// config and the mailer that can be swapped out by a SIGHUP reload.
 type application struct {
-	config config
-	logger *greenlog.Greenlog
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config  config
+	logger  *greenlog.Greenlog
+	models  data.Models
+	cache   *data.MovieCache
+	mailer  mailer.Mailer
+	limiter limiterStore
+	mu      sync.RWMutex
+	wg      sync.WaitGroup
 }
 
 func main() {
@@ -57,45 +118,279 @@ func main() {
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development",
 		"Environment (development/staging/production)")
+	flag.StringVar(&cfg.configFile, "config", "",
+		"JSON file with settings that are re-read on SIGHUP")
+	flag.StringVar(&cfg.logLevel, "log-level", "INFO",
+		"Minimum log level (DEBUG/INFO/WARN/ERROR/FATAL/OFF)")
+	flag.StringVar(&cfg.logFormat, "log-format", "json",
+		"Log format (json/logfmt/console)")
+	flag.StringVar(&cfg.logStacks, "log-stacks", "ERROR",
+		"Lowest log level whose entries include a stack trace, or OFF")
+	flag.StringVar(&cfg.logFile.path, "log-file", "",
+		"Also write logs to this file, which is rotated")
+	flag.StringVar(&cfg.logFile.level, "log-file-level", "DEBUG",
+		"Minimum level of entries written to -log-file, on top of -log-level")
+	flag.StringVar(&cfg.logFile.format, "log-file-format", "json",
+		"Format of -log-file (json/logfmt/console)")
+	flag.IntVar(&cfg.logFile.maxSize, "log-file-max-size", 100,
+		"Size in megabytes at which -log-file is rotated (0 for no limit)")
+	flag.DurationVar(&cfg.logFile.rotate, "log-file-rotate", 24*time.Hour,
+		"Age at which -log-file is rotated (0 for no limit)")
+	flag.IntVar(&cfg.logFile.maxBackups, "log-file-max-backups", 7,
+		"Rotated log files to keep (0 to keep them all)")
+	flag.BoolVar(&cfg.logFile.compress, "log-file-compress", true,
+		"Gzip rotated log files")
+	flag.IntVar(&cfg.logSampling.first, "log-sample-first", 0,
+		"DEBUG and INFO entries with the same message written each second before sampling starts (0 to write them all)")
+	flag.IntVar(&cfg.logSampling.thereafter, "log-sample-thereafter", 100,
+		"Once sampling starts, write one in this many entries with the same message")
+
+	flag.StringVar(&cfg.tracing.exporter, "trace-exporter", "none",
+		"Where to send trace spans (none/stdout/file)")
+	flag.StringVar(&cfg.tracing.file, "trace-file", "tmp/traces.jsonl",
+		"File the file trace exporter appends spans to")
+	flag.Float64Var(&cfg.tracing.sampleRatio, "trace-sample-ratio", 1,
+		"Fraction of new traces to record, from 0 to 1")
+
+	flag.BoolVar(&cfg.problemDetails, "problem-details", false,
+		"Send every error as RFC 7807 problem+json, not only to clients which accept it")
 
+	flag.StringVar(&cfg.db.backend, "db-backend", "postgres",
+		"Data backend (postgres/memory)")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("GREENLIGHT_DB_DSN"),
 		"PostgreSQL DSN")
+	flag.StringVar(&cfg.db.replicaDSN, "db-replica-dsn", os.Getenv("GREENLIGHT_DB_REPLICA_DSN"),
+		"PostgreSQL read replica DSN for movie reads (optional)")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25,
 		"PostgresQL max open connection")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25,
 		"PostgreSQL max idle connection")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m",
 		"PostgreSQL max connection idle time")
+	flag.BoolVar(&cfg.db.migrate, "db-migrate", false,
+		"Apply pending database migrations at startup")
+	defaultTimeouts := data.DefaultTimeouts()
+	flag.DurationVar(&cfg.db.timeouts.Read, "db-read-timeout", defaultTimeouts.Read,
+		"Maximum time for a query fetching a single record (0 for no limit)")
+	flag.DurationVar(&cfg.db.timeouts.List, "db-list-timeout", defaultTimeouts.List,
+		"Maximum time for a query listing records (0 for no limit)")
+	flag.DurationVar(&cfg.db.timeouts.Write, "db-write-timeout", defaultTimeouts.Write,
+		"Maximum time for an insert, update or delete (0 for no limit)")
+	flag.DurationVar(&cfg.db.timeouts.RateLimit, "db-rate-limit-timeout", defaultTimeouts.RateLimit,
+		"Maximum time for a postgres rate limiter update (0 for no limit)")
 
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2,
 		"Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4,
 		"Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.StringVar(&cfg.limiter.store, "limiter-store", "memory",
+		"Rate limiter store (memory/postgres)")
+	flag.Func("limiter-tiers", "Rate limiter tiers as name=rps:burst (space separated)", func(val string) error {
+		tiers, err := parseLimiterTiers(val)
+		cfg.limiter.tiers = tiers
+		return err
+	})
+	flag.Func("limiter-api-keys", "API keys and their tier as key=tier (space separated)", func(val string) error {
+		keys, err := parseAPIKeys(val)
+		cfg.limiter.apiKeys = keys
+		return err
+	})
+	flag.Func("limiter-trusted-proxies", "Trusted proxy IPs or CIDR ranges (space separated)", func(val string) error {
+		proxies, err := parseTrustedProxies(strings.Fields(val))
+		cfg.limiter.trustedProxies = proxies
+		return err
+	})
 
-	flag.StringVar(&cfg.smtp.host, "smtp-host", "smtp.mailtrap.io", "SMTP host")
+	flag.StringVar(&cfg.mail.transport, "mail-transport", "log",
+		"How emails are delivered (smtp/file/log)")
+	flag.StringVar(&cfg.mail.dir, "mail-dir", "tmp/mail",
+		"Maildir the file mail transport writes emails to")
+
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", "f6ba216c2c45b2", "SMTP username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", "5fe2e2b3196f68", "SMTP password")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("GREENLIGHT_SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("GREENLIGHT_SMTP_PASSWORD"), "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.jahid.net>", "SMTP sender")
 
+	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
+		cfg.cors.trustedOrigins = strings.Fields(val)
+		return nil
+	})
+
+	flag.StringVar(&cfg.tls.certFile, "tls-cert", "", "TLS certificate file (enables HTTPS)")
+	flag.StringVar(&cfg.tls.keyFile, "tls-key", "", "TLS private key file")
+	flag.IntVar(&cfg.tls.redirectPort, "tls-redirect-port", 0,
+		"Plain HTTP port to redirect to HTTPS (0 disables)")
+
+	flag.BoolVar(&cfg.compression.enabled, "compression-enabled", true,
+		"Compress responses with gzip or brotli")
+	flag.IntVar(&cfg.compression.minSize, "compression-min-size", 1024,
+		"Minimum response size in bytes to compress")
+	cfg.compression.exemptTypes = defaultCompressionExemptTypes
+	flag.Func("compression-exempt-types", "Content types never to compress (space separated, a trailing / matches all subtypes)", func(val string) error {
+		cfg.compression.exemptTypes = strings.Fields(strings.ToLower(val))
+		return nil
+	})
+
+	flag.BoolVar(&cfg.cache.enabled, "cache-enabled", true, "Cache movie reads in memory")
+	flag.IntVar(&cfg.cache.size, "cache-size", 1000,
+		"Maximum number of movies and movie lists to cache")
+	flag.DurationVar(&cfg.cache.ttl, "cache-ttl", 30*time.Second,
+		"How long to cache a movie or movie list for")
+
+	flag.IntVar(&cfg.jobs.workers, "jobs-workers", 2,
+		"Number of background job workers (0 leaves jobs queued for other instances)")
+	flag.DurationVar(&cfg.jobs.pollInterval, "jobs-poll-interval", time.Second,
+		"How often an idle job worker looks for new jobs")
+	flag.IntVar(&cfg.jobs.maxAttempts, "jobs-max-attempts", 5,
+		"Attempts at a background job before it is marked dead")
+
 	flag.Parse()
 
 	logger := greenlog.New(os.Stdout, greenlog.LevelInfo)
 
-	db, err := openDB(cfg)
+	// Settings from the -config file take precedence over the command line
+	// flags, so that the values in effect after a SIGHUP match the values
+	// the server would have if it were restarted.
+	if cfg.configFile != "" {
+		rc, err := readReloadableConfig(cfg.configFile)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		rc.apply(&cfg)
+	}
+
+	if (cfg.tls.certFile == "") != (cfg.tls.keyFile == "") {
+		logger.PrintFatal(errors.New("-tls-cert and -tls-key must be used together"), nil)
+	}
+
+	level, err := greenlog.ParseLevel(cfg.logLevel)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	logger.SetLevel(level)
+
+	format, err := greenlog.ParseFormat(cfg.logFormat)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	logger.SetFormat(format)
+
+	stackLevel, err := greenlog.ParseLevel(cfg.logStacks)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
-	defer db.Close()
+	logger.SetStackLevel(stackLevel)
+
+	// Send everything logged through log/slog or the standard log package,
+	// by dependencies for example, to the same place as our own entries.
+	slog.SetDefault(slog.New(greenlog.NewHandler(logger)))
+
+	logger.SetSampling(greenlog.Sampling{
+		Tick:       time.Second,
+		First:      cfg.logSampling.first,
+		Thereafter: cfg.logSampling.thereafter,
+	})
+
+	tracer, closeTracer, err := newTracer(cfg, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	defer closeTracer()
+	tracing.SetDefault(tracer)
+
+	if cfg.logFile.path != "" {
+		logFile, err := openLogFile(cfg, logger)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		defer logFile.Close()
+	}
+
+	var models data.Models
+
+	switch cfg.db.backend {
+	case "postgres":
+		db, err := openDB(cfg, cfg.db.dsn)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		defer db.Close()
+
+		logger.PrintInfo("database connection pool established", nil)
+
+		// "api migrate ..." manages the database schema and exits, without
+		// starting the server.
+		if flag.Arg(0) == "migrate" {
+			err = migrateCommand(db, logger, flag.Args()[1:], os.Stdout)
+			if err != nil {
+				logger.PrintFatal(err, nil)
+			}
+			return
+		}
+
+		if cfg.db.migrate {
+			err = runMigrations(db, logger)
+			if err != nil {
+				logger.PrintFatal(err, nil)
+			}
+		}
+
+		var replica *data.Replica
+		if cfg.db.replicaDSN != "" {
+			// The replica isn't pinged here; if it's down the API starts
+			// anyway and reads from the primary until it comes back.
+			replicaDB, err := openPool(cfg, cfg.db.replicaDSN)
+			if err != nil {
+				logger.PrintFatal(err, nil)
+			}
+			defer replicaDB.Close()
+
+			replica = data.NewReplica(replicaDB)
+			go monitorReplica(replica, logger)
+		}
+
+		models = data.NewModels(db, replica, cfg.db.timeouts)
 
-	logger.PrintInfo("database connection pool established", nil)
+	case "memory":
+		if flag.Arg(0) == "migrate" || cfg.db.migrate {
+			logger.PrintFatal(errors.New("migrations need the postgres backend"), nil)
+		}
+		if cfg.db.replicaDSN != "" {
+			logger.PrintFatal(errors.New("-db-replica-dsn needs the postgres backend"), nil)
+		}
+
+		logger.PrintInfo("using in-memory data backend, nothing will be saved", nil)
+		models = data.NewMemoryModels()
+
+	default:
+		logger.PrintFatal(fmt.Errorf("unknown database backend %q", cfg.db.backend), nil)
+	}
+
+	// The cache only sees writes made by this instance, so with several
+	// instances a movie can be out of date for up to -cache-ttl.
+	var cache *data.MovieCache
+	if cfg.cache.enabled {
+		models, cache = models.WithMovieCache(cfg.cache.size, cfg.cache.ttl, cfg.db.timeouts)
+	}
+
+	appMailer, err := newMailer(cfg, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
 	app := &application{
 		config: cfg,
 		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		models: models,
+		cache:  cache,
+		mailer: appMailer,
+	}
+
+	app.limiter, err = newLimiterStore(cfg.limiter.store, models, logger, app.limiterStaleAge)
+	if err != nil {
+		logger.PrintFatal(err, nil)
 	}
 
 	err = app.serve()
@@ -104,19 +399,35 @@ func main() {
 	}
 }
 
-func openDB(cfg config) (*sql.DB, error) {
-	db, err := sql.Open("postgres", cfg.db.dsn)
+// openLogFile opens -log-file and adds it to the logger's sinks.
+func openLogFile(cfg config, logger *greenlog.Greenlog) (*greenlog.RotatingFile, error) {
+	level, err := greenlog.ParseLevel(cfg.logFile.level)
+	if err != nil {
+		return nil, err
+	}
+	format, err := greenlog.ParseFormat(cfg.logFile.format)
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxOpenConns(cfg.db.maxOpenConns)
-	db.SetMaxIdleConns(cfg.db.maxIdleConns)
 
-	duration, err := time.ParseDuration(cfg.db.maxIdleTime)
+	file, err := greenlog.OpenRotatingFile(cfg.logFile.path, greenlog.RotateOptions{
+		MaxSize:    int64(cfg.logFile.maxSize) * 1024 * 1024,
+		Interval:   cfg.logFile.rotate,
+		MaxBackups: cfg.logFile.maxBackups,
+		Compress:   cfg.logFile.compress,
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.AddSink(greenlog.Sink{Out: file, MinLevel: level, Format: format})
+	return file, nil
+}
+
+func openDB(cfg config, dsn string) (*sql.DB, error) {
+	db, err := openPool(cfg, dsn)
 	if err != nil {
 		return nil, err
 	}
-	db.SetConnMaxIdleTime(duration)
 	// create a context witha 5-second timeout deadline
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -127,8 +438,53 @@ func openDB(cfg config) (*sql.DB, error) {
 	// will return an error.
 	err = db.PingContext(ctx)
 	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// openPool sets up a connection pool for dsn with the pool settings from cfg,
+// without connecting to the database yet.
+func openPool(cfg config, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.db.maxOpenConns)
+	db.SetMaxIdleConns(cfg.db.maxIdleConns)
+
+	duration, err := time.ParseDuration(cfg.db.maxIdleTime)
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
+	db.SetConnMaxIdleTime(duration)
 
 	return db, nil
 }
+
+// newMailer returns a mailer which delivers emails with the -mail-transport.
+// Only the smtp transport sends anything over the network; the others are
+// for development and CI.
+func newMailer(cfg config, logger *greenlog.Greenlog) (mailer.Mailer, error) {
+	var transport mailer.Transport
+
+	switch cfg.mail.transport {
+	case "smtp":
+		transport = mailer.NewSMTPTransport(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password)
+	case "file":
+		t, err := mailer.NewFileTransport(cfg.mail.dir)
+		if err != nil {
+			return mailer.Mailer{}, err
+		}
+		transport = t
+	case "log":
+		transport = mailer.NewLogTransport(logger)
+	default:
+		return mailer.Mailer{}, fmt.Errorf("unknown mail transport %q", cfg.mail.transport)
+	}
+
+	return mailer.New(transport, cfg.smtp.sender)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+)
+
+// metricsHandler reports counters for monitoring. Sections for features
+// which are switched off are left out.
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics := envelope{}
+
+	if app.cache != nil {
+		metrics["movie_cache"] = app.cache.Stats()
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"metrics": metrics}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
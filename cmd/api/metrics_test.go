@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	token := ts.registerAdmin(t, "Admin", "admin@example.com", "pa55word1234")
+	ts.registerUser(t, "Alice", "alice@example.com", "pa55word1234")
+	userToken := ts.authenticate(t, "alice@example.com", "pa55word1234")
+
+	ts.request(t, http.MethodGet, "/v1/metrics").do().
+		expectStatus(http.StatusUnauthorized)
+	ts.request(t, http.MethodGet, "/v1/metrics").withToken(userToken).do().
+		expectStatus(http.StatusForbidden)
+	ts.request(t, http.MethodGet, "/v1/metrics").withToken(token).do().
+		expectStatus(http.StatusOK)
+}
@@ -1,15 +1,63 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"net"
 	"net/http"
-	"sync"
-	"time"
+	"strconv"
+	"strings"
 
-	"golang.org/x/time/rate"
+	"github.com/jahidhimon/greenlight.git/internal/data"
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+	"github.com/jahidhimon/greenlight.git/internal/tracing"
+	"github.com/jahidhimon/greenlight.git/internal/validator"
 )
 
+// requestID gives every request an ID, which is sent back in the X-Request-ID
+// header and included in error responses and logs, so that a client's report
+// of a failed request can be matched with the logs. An X-Request-ID sent by
+// the client, or a proxy in front of the API, is used if it looks safe to log.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		r = app.contextSetRequestID(r, id)
+		tracing.SpanFromContext(r.Context()).SetAttributes(tracing.String("http.request_id", id))
+
+		fields := append([]greenlog.Field{greenlog.String("request_id", id)}, traceFields(r.Context())...)
+		r = app.contextSetLogger(r, app.logger.With(fields...))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID reports whether id is short and only contains letters,
+// digits, '-', '_' and '.'.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Create a deferred function (which will always be run in the event  of
@@ -33,63 +81,256 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-// This is middleware for limiting rate of requests per second
+// This is middleware for limiting rate of requests per second. Each client
+// gets its own token bucket in the limiter store, keyed by API key,
+// authenticated user or IP address (see rateLimitKey), and every response
+// carries RateLimit-* headers describing the state of that bucket.
 func (app *application) rateLimit(next http.Handler) http.Handler {
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
-	}
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
-
-	// Launch a background goroutine which removes old entries from the clients
-	// map once every minute
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			mu.Lock()
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
-			mu.Unlock()
-		}
-	}()
-
-	// Initialize a ne4w rate limiter which allows an avg 2 req/sec.
-	// with a maximum of 4 req in a single 'burst
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.limiter.enabled {
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		lc := app.currentLimiterConfig()
+		if lc.enabled {
+			key, tier, err := app.rateLimitKey(r, lc)
 			if err != nil {
 				app.serverErrorResponse(w, r, err)
 				return
 			}
+			if !app.takeRateLimitToken(w, r, key, tier) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// takeRateLimitToken takes a token from the bucket for key and sets the
+// RateLimit headers. If the bucket is empty it sends a 429 response and
+// returns false.
+func (app *application) takeRateLimitToken(w http.ResponseWriter, r *http.Request, key string, tier limiterTier) bool {
+	allowed, tokens, err := app.limiter.Allow(r.Context(), key, tier.rps, tier.burst)
+	if err != nil {
+		// Don't turn a problem with the limiter store into an outage of
+		// the whole API; log it and let the request through unlimited.
+		app.logError(r, err)
+		return true
+	}
+
+	setRateLimitHeaders(w, tier, tokens)
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter(tier, tokens)))
+		app.rateLimitExcededResponse(w, r)
+		return false
+	}
+	return true
+}
+
+// chargeClientIP takes a token from the client IP's bucket for a request
+// which never reaches rateLimit. It returns false if it sent a response.
+func (app *application) chargeClientIP(w http.ResponseWriter, r *http.Request) bool {
+	lc := app.currentLimiterConfig()
+	if !lc.enabled {
+		return true
+	}
 
-			mu.Lock()
+	key, tier, err := ipRateLimitKey(r, lc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	return app.takeRateLimitToken(w, r, key, tier)
+}
 
-			// Check to see if the IP adress already exists in the map
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{
-					limiter: rate.NewLimiter(
-						rate.Limit(app.config.limiter.rps),
-						app.config.limiter.burst)}
+// authenticate adds the user a request's bearer token belongs to to the
+// request context. Requests without an Authorization header carry on
+// anonymously; a header with a bad token gets a 401, which is charged to the
+// client IP's rate limit so that guessing tokens is limited too.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on who the user is, so caches must not
+		// share it between users.
+		w.Header().Add("Vary", "Authorization")
+
+		invalidToken := func() {
+			if app.chargeClientIP(w, r) {
+				app.invalidAuthenticationTokenResponse(w, r)
 			}
+		}
 
-			clients[ip].lastSeen = time.Now()
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-			// Call the Allow() method on the rate limiter for the current IP
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
-				app.rateLimitExcededResponse(w, r)
-				return
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			invalidToken()
+			return
+		}
+		token := headerParts[1]
+
+		v := validator.New()
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			invalidToken()
+			return
+		}
+
+		user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				invalidToken()
+			default:
+				app.serverErrorResponse(w, r, err)
 			}
+			return
+		}
 
-			mu.Unlock()
+		r = app.contextSetUser(r, user)
+		r = app.contextSetLogger(r, app.contextGetLogger(r).With(greenlog.Int64("user_id", user.ID)))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requirePermission only lets activated users with the permission code
+// through to next.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if user == nil {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
 		}
+
 		next.ServeHTTP(w, r)
+	}
+}
+
+// enableCORS adds the CORS headers which let browser frontends served from one
+// of the -cors-trusted-origins call the API. Simple requests from a trusted
+// origin get an Access-Control-Allow-Origin header and are passed on as normal.
+// Preflight requests are handed to the router, which knows which methods are
+// registered for the path and answers them through preflightHandler.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on the Origin header, so caches must not share
+		// it between origins.
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions &&
+			r.Header.Get("Access-Control-Request-Method") != ""
+
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin != "" {
+			if !isTrustedOrigin(origin, app.trustedOrigins()) {
+				// Without the Access-Control-Allow-Origin header the browser
+				// won't let the frontend read the response of a simple
+				// request. A preflight from an untrusted origin can be
+				// refused outright.
+				if preflight {
+					app.errorResponse(w, r, http.StatusForbidden, "origin not allowed")
+					return
+				}
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsAllowedHeaders lists the request headers the API reads, which browsers
+// only send on a cross-origin request if the preflight response allows them.
+// A header the API starts reading should be added here too.
+var corsAllowedHeaders = []string{
+	"Accept-Language",
+	"Authorization",
+	"Content-Type",
+	"X-API-Key",
+	"X-Expected-Version",
+	"X-Request-ID",
+	"traceparent",
+}
+
+// preflightHandler is used as the router's GlobalOPTIONS handler. httprouter
+// sets the Allow header to the methods registered for the requested path
+// before calling it, so we can answer the preflight with exactly those.
+func (app *application) preflightHandler(w http.ResponseWriter, r *http.Request) {
+	requestMethod := r.Header.Get("Access-Control-Request-Method")
+	if requestMethod == "" || w.Header().Get("Access-Control-Allow-Origin") == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	allowed := w.Header().Get("Allow")
+	if !validator.In(requestMethod, strings.Split(allowed, ", ")...) {
+		app.methodNotAllowedResponse(w, r)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", allowed)
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+	w.Header().Set("Access-Control-Max-Age", "600")
+	w.WriteHeader(http.StatusOK)
+}
+
+// isTrustedOrigin reports whether origin is in the trusted list. A "*" entry
+// trusts every origin.
+func isTrustedOrigin(origin string, trusted []string) bool {
+	for _, t := range trusted {
+		if t == "*" || t == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// compressResponse gzip or brotli compresses responses for clients which
+// advertise support for it in Accept-Encoding. Small responses, and content
+// types on the -compression-exempt-types list, are sent uncompressed.
+func (app *application) compressResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Whether or not this particular response is compressed, the
+		// representation depends on Accept-Encoding.
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if !app.config.compression.enabled || encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        app.config.compression.minSize,
+			exempt:         app.config.compression.exemptTypes,
+		}
+		defer func() {
+			if err := cw.close(); err != nil {
+				app.logError(r, err)
+			}
+		}()
+
+		next.ServeHTTP(cw, r)
 	})
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+)
+
+func TestRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.limiter = limiterConfig{
+		rps:     0.1,
+		burst:   2,
+		enabled: true,
+		tiers:   map[string]limiterTier{"partner": {rps: 0.1, burst: 5}},
+		apiKeys: map[string]string{"partner-key": "partner"},
+	}
+	ts := newTestServer(t, app)
+
+	// The default tier allows a burst of two requests.
+	ts.request(t, http.MethodGet, "/v1/healthcheck").do().
+		expectStatus(http.StatusOK).
+		expectHeader("RateLimit-Limit", "2").
+		expectHeader("RateLimit-Remaining", "1")
+	ts.request(t, http.MethodGet, "/v1/healthcheck").do().
+		expectStatus(http.StatusOK).
+		expectHeader("RateLimit-Remaining", "0")
+
+	res := ts.request(t, http.MethodGet, "/v1/healthcheck").do().
+		expectStatus(http.StatusTooManyRequests).
+		expectHeader("RateLimit-Remaining", "0")
+	if res.Header.Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+
+	// A known API key gets its own bucket and tier.
+	ts.request(t, http.MethodGet, "/v1/healthcheck").withAPIKey("partner-key").do().
+		expectStatus(http.StatusOK).
+		expectHeader("RateLimit-Limit", "5")
+
+	// An unknown API key is counted against the client IP.
+	ts.request(t, http.MethodGet, "/v1/healthcheck").withAPIKey("made-up").do().
+		expectStatus(http.StatusTooManyRequests)
+}
+
+func TestRoutingErrors(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	ts.request(t, http.MethodGet, "/v1/nothing-here").do().
+		expectStatus(http.StatusNotFound)
+	ts.request(t, http.MethodPut, "/v1/movies/1").do().
+		expectStatus(http.StatusMethodNotAllowed)
+}
+
+func TestEnableCORS(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.cors.trustedOrigins = []string{"https://frontend.example.com"}
+	ts := newTestServer(t, app)
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		wantStatus  int
+		wantAllowed string
+		wantMethods string
+	}{
+		{
+			name:        "simple request from trusted origin",
+			method:      http.MethodGet,
+			origin:      "https://frontend.example.com",
+			wantStatus:  http.StatusOK,
+			wantAllowed: "https://frontend.example.com",
+		},
+		{
+			name:       "simple request from untrusted origin",
+			method:     http.MethodGet,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "preflight from trusted origin",
+			method:      http.MethodOptions,
+			origin:      "https://frontend.example.com",
+			wantStatus:  http.StatusOK,
+			wantAllowed: "https://frontend.example.com",
+			wantMethods: "GET, OPTIONS",
+		},
+		{
+			name:       "preflight from untrusted origin",
+			method:     http.MethodOptions,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ts.request(t, tt.method, "/v1/healthcheck").withHeader("Origin", tt.origin)
+			if tt.method == http.MethodOptions {
+				req.withHeader("Access-Control-Request-Method", http.MethodGet)
+			}
+
+			req.do().
+				expectStatus(tt.wantStatus).
+				expectHeader("Access-Control-Allow-Origin", tt.wantAllowed).
+				expectHeader("Access-Control-Allow-Methods", tt.wantMethods)
+		})
+	}
+}
+
+func TestPreflightAllowedHeaders(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.cors.trustedOrigins = []string{"https://frontend.example.com"}
+	ts := newTestServer(t, app)
+
+	res := ts.request(t, http.MethodOptions, "/v1/movies").
+		withHeader("Origin", "https://frontend.example.com").
+		withHeader("Access-Control-Request-Method", http.MethodGet).
+		do().expectStatus(http.StatusOK)
+
+	allowed := make(map[string]bool)
+	for _, header := range strings.Split(res.Header.Get("Access-Control-Allow-Headers"), ",") {
+		allowed[http.CanonicalHeaderKey(strings.TrimSpace(header))] = true
+	}
+
+	// Every header a browser client may send to the API.
+	for _, header := range []string{
+		"Accept-Language",
+		"Authorization",
+		"Content-Type",
+		"X-API-Key",
+		"X-Expected-Version",
+		"X-Request-ID",
+		"traceparent",
+	} {
+		if !allowed[http.CanonicalHeaderKey(header)] {
+			t.Errorf("Access-Control-Allow-Headers doesn't include %s", header)
+		}
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	traceSpans(t)
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	user := ts.registerUser(t, "Alice", "alice@example.com", "pa55word1234")
+	token := ts.authenticate(t, "alice@example.com", "pa55word1234")
+
+	var buf bytes.Buffer
+	app.logger = greenlog.New(&buf, greenlog.LevelInfo)
+
+	handler := app.traceRequest(app.requestID(app.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.logError(r, errors.New("boom"))
+	}))))
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies?page=2", nil)
+	r.Header.Set("X-Request-ID", "abc-123")
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var entry struct {
+		Level      string                 `json:"level"`
+		Message    string                 `json:"message"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%v in %s", err, buf.String())
+	}
+	if entry.Level != "ERROR" || entry.Message != "boom" {
+		t.Errorf("got %+v", entry)
+	}
+	want := map[string]interface{}{
+		"request_id":     "abc-123",
+		"user_id":        float64(user.ID),
+		"request_method": "GET",
+		"request_url":    "/v1/movies?page=2",
+		"trace_id":       "4bf92f3577b34da6a3ce929d0e0e4736",
+	}
+	for key, value := range want {
+		if entry.Properties[key] != value {
+			t.Errorf("got %s = %#v; want %#v", key, entry.Properties[key], value)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+	"github.com/jahidhimon/greenlight.git/internal/migrate"
+	"github.com/jahidhimon/greenlight.git/migrations"
+)
+
+const migrateUsage = `usage: api [flags] migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    roll back the last N migrations (default 1)
+  goto V      migrate up or down to version V (0 rolls back everything)
+  status      show the current version and pending migrations`
+
+// runMigrations applies any pending migrations at startup when the
+// -db-migrate flag is set.
+func runMigrations(db *sql.DB, logger *greenlog.Greenlog) error {
+	m, err := migrate.New(db, migrations.FS, logger)
+	if err != nil {
+		return err
+	}
+
+	// Other instances may be holding the migration lock, so allow plenty of
+	// time for them to finish.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		return err
+	}
+	logger.PrintInfo("database migrations complete", map[string]string{
+		"applied": strconv.Itoa(applied),
+	})
+	return nil
+}
+
+// migrateCommand implements the "migrate" subcommand. Status output goes to
+// out; progress is logged as usual.
+func migrateCommand(db *sql.DB, logger *greenlog.Greenlog, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	m, err := migrate.New(db, migrations.FS, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		_, err = m.Up(ctx)
+		return err
+
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		_, err = m.Down(ctx, steps)
+		return err
+
+	case args[0] == "goto" && len(args) == 2:
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		_, err = m.Goto(ctx, version)
+		return err
+
+	case args[0] == "status" && len(args) == 1:
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "version: %d", status.Version)
+		if status.Dirty {
+			fmt.Fprint(out, " (dirty)")
+		}
+		fmt.Fprintln(out)
+
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATE")
+		for _, ms := range status.Migrations {
+			state := "pending"
+			if ms.Applied {
+				state = "applied"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", ms.Version, ms.Name, state)
+		}
+		return tw.Flush()
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -36,13 +36,13 @@ func (a *application) createMovieHandler(w http.ResponseWriter, r *http.Request)
 	v := validator.New()
 
 	if data.ValidateMovie(v, movie); !v.Valid() {
-		a.failedValidationResponse(w, r, v.Errors)
+		a.failedValidationResponse(w, r, v)
 		return
 	}
 
 	// Call the Insert() method on our movies model, passing in a pointer
 	// to the validated movie struct.
-	err = a.models.Movies.Insert(movie)
+	err = a.models.Movies.Insert(r.Context(), movie)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -65,7 +65,7 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		app.notFoundResponse(w, r)
 		return
 	}
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -89,7 +89,9 @@ func (a *application) updateMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := a.models.Movies.Get(id)
+	// Read the movie from the primary, as a stale copy from the replica
+	// would fail the version check in Update.
+	movie, err := a.models.Movies.Get(data.UsePrimary(r.Context()), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -100,7 +102,7 @@ func (a *application) updateMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	if r.Header.Get("X-Expected-Version") != "" {
-		if strconv.FormatInt(int64(movie.Version), 32) != r.Header.Get("X-Exprected-Version") {
+		if strconv.FormatInt(int64(movie.Version), 10) != r.Header.Get("X-Expected-Version") {
 			a.editConflictResponse(w, r)
 			return
 		}
@@ -132,11 +134,11 @@ func (a *application) updateMovieHandler(w http.ResponseWriter, r *http.Request)
 
 	v := validator.New()
 	if data.ValidateMovie(v, movie); !v.Valid() {
-		a.failedValidationResponse(w, r, v.Errors)
+		a.failedValidationResponse(w, r, v)
 		return
 	}
 
-	err = a.models.Movies.Update(movie)
+	err = a.models.Movies.Update(r.Context(), movie)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -160,7 +162,7 @@ func (a *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err = a.models.Movies.Delete(id); err != nil {
+	if err = a.models.Movies.Delete(r.Context(), id); err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			a.notFoundResponse(w, r)
@@ -198,10 +200,10 @@ func (app *application) listMovieHandler(w http.ResponseWriter, r *http.Request)
 		"-id", "-title", "-year", "-runtime"}
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(r.Context(), input.Title, input.Genres, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
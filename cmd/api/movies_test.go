@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCreateMovieHandler(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	tests := []struct {
+		name       string
+		body       interface{}
+		wantStatus int
+		wantErrors []string
+	}{
+		{
+			name:       "valid",
+			body:       `{"title": "Moana", "year": 2016, "runtime": "107 mins", "genres": ["animation", "adventure"]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "empty body",
+			body:       ``,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "badly formed JSON",
+			body:       `{"title": "Moana", }`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown field",
+			body:       `{"title": "Moana", "rating": "PG"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong type",
+			body:       `{"title": 123}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "bad runtime format",
+			body:       `{"title": "Moana", "year": 2016, "runtime": 107, "genres": ["animation"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "trailing JSON value",
+			body:       `{"title": "Moana"} {"title": "Frozen"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing fields",
+			body:       `{}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []string{"title", "year", "runtime", "genres"},
+		},
+		{
+			name:       "invalid values",
+			body:       `{"title": "Moana", "year": 1700, "runtime": "-1 mins", "genres": ["drama", "drama"]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []string{"year", "runtime", "genres"},
+		},
+		{
+			name:       "too many genres",
+			body:       `{"title": "Moana", "year": 2016, "runtime": "107 mins", "genres": ["a", "b", "c", "d", "e", "f"]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []string{"genres"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/movies").withJSON(tt.body).do().
+				expectStatus(tt.wantStatus)
+
+			if tt.wantErrors != nil {
+				res.expectErrorKeys(tt.wantErrors...)
+			}
+
+			if tt.wantStatus == http.StatusOK {
+				var env struct {
+					Movie testMovie `json:"movie"`
+				}
+				res.decode(&env)
+				res.expectHeader("Location", fmt.Sprintf("/v1/movies/%d", env.Movie.ID))
+				if env.Movie.Version != 1 {
+					t.Errorf("got version %d; want 1", env.Movie.Version)
+				}
+			}
+		})
+	}
+}
+
+func TestShowMovieHandler(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+	movie := ts.createMovie(t, "Moana", 2016, 107, "animation", "adventure")
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"existing movie", fmt.Sprintf("/v1/movies/%d", movie.ID), http.StatusOK},
+		{"missing movie", "/v1/movies/999", http.StatusNotFound},
+		{"zero id", "/v1/movies/0", http.StatusNotFound},
+		{"negative id", "/v1/movies/-1", http.StatusNotFound},
+		{"non-numeric id", "/v1/movies/abc", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodGet, tt.path).do().expectStatus(tt.wantStatus)
+
+			if tt.wantStatus == http.StatusOK {
+				var env struct {
+					Movie testMovie `json:"movie"`
+				}
+				res.decode(&env)
+				if env.Movie.Title != "Moana" || env.Movie.Runtime != "107 mins" {
+					t.Errorf("got %+v", env.Movie)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateMovieHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		header     map[string]string
+		body       string
+		wantStatus int
+		wantErrors []string
+		wantTitle  string
+	}{
+		{
+			name:       "partial update",
+			body:       `{"title": "Moana 2"}`,
+			wantStatus: http.StatusOK,
+			wantTitle:  "Moana 2",
+		},
+		{
+			name:       "matching expected version",
+			header:     map[string]string{"X-Expected-Version": "1"},
+			body:       `{"year": 2017}`,
+			wantStatus: http.StatusOK,
+			wantTitle:  "Moana",
+		},
+		{
+			name:       "stale expected version",
+			header:     map[string]string{"X-Expected-Version": "7"},
+			body:       `{"year": 2017}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "invalid value",
+			body:       `{"genres": []}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []string{"genres"},
+		},
+		{
+			name:       "badly formed JSON",
+			body:       `{"title": }`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing movie",
+			path:       "/v1/movies/999",
+			body:       `{"title": "Moana 2"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid id",
+			path:       "/v1/movies/abc",
+			body:       `{"title": "Moana 2"}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each case gets a fresh movie at version 1.
+			ts := newTestServer(t, newTestApplication(t))
+			movie := ts.createMovie(t, "Moana", 2016, 107, "animation", "adventure")
+
+			path := tt.path
+			if path == "" {
+				path = fmt.Sprintf("/v1/movies/%d", movie.ID)
+			}
+
+			req := ts.request(t, http.MethodPatch, path).withJSON(tt.body)
+			for key, value := range tt.header {
+				req.withHeader(key, value)
+			}
+			res := req.do().expectStatus(tt.wantStatus)
+
+			if tt.wantErrors != nil {
+				res.expectErrorKeys(tt.wantErrors...)
+			}
+
+			if tt.wantStatus == http.StatusOK {
+				var env struct {
+					Movie testMovie `json:"movie"`
+				}
+				res.decode(&env)
+				if env.Movie.Title != tt.wantTitle {
+					t.Errorf("got title %q; want %q", env.Movie.Title, tt.wantTitle)
+				}
+				if env.Movie.Version != 2 {
+					t.Errorf("got version %d; want 2", env.Movie.Version)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteMovieHandler(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+	movie := ts.createMovie(t, "Moana", 2016, 107, "animation", "adventure")
+	path := fmt.Sprintf("/v1/movies/%d", movie.ID)
+
+	ts.request(t, http.MethodDelete, path).do().expectStatus(http.StatusOK)
+	ts.request(t, http.MethodGet, path).do().expectStatus(http.StatusNotFound)
+	ts.request(t, http.MethodDelete, path).do().expectStatus(http.StatusNotFound)
+	ts.request(t, http.MethodDelete, "/v1/movies/abc").do().expectStatus(http.StatusNotFound)
+}
+
+func TestListMovieHandler(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+	ts.createMovie(t, "Moana", 2016, 107, "animation", "adventure")
+	ts.createMovie(t, "Black Panther", 2018, 134, "action", "adventure")
+	ts.createMovie(t, "Deadpool", 2016, 108, "action", "comedy")
+	ts.createMovie(t, "The Breakfast Club", 1985, 96, "drama")
+
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantTitles  []string
+		wantTotal   int
+		wantErrors  []string
+		wantLastPag int
+	}{
+		{
+			name:       "default order",
+			query:      "",
+			wantStatus: http.StatusOK,
+			wantTitles: []string{"Moana", "Black Panther", "Deadpool", "The Breakfast Club"},
+			wantTotal:  4,
+		},
+		{
+			name:       "title search",
+			query:      "?title=breakfast+club",
+			wantStatus: http.StatusOK,
+			wantTitles: []string{"The Breakfast Club"},
+			wantTotal:  1,
+		},
+		{
+			name:       "genre filter",
+			query:      "?genres=action,adventure",
+			wantStatus: http.StatusOK,
+			wantTitles: []string{"Black Panther"},
+			wantTotal:  1,
+		},
+		{
+			name:       "sort descending with id tie break",
+			query:      "?sort=-year",
+			wantStatus: http.StatusOK,
+			wantTitles: []string{"Black Panther", "Moana", "Deadpool", "The Breakfast Club"},
+			wantTotal:  4,
+		},
+		{
+			name:        "pagination",
+			query:       "?sort=title&page=2&page_size=2",
+			wantStatus:  http.StatusOK,
+			wantTitles:  []string{"Moana", "The Breakfast Club"},
+			wantTotal:   4,
+			wantLastPag: 2,
+		},
+		{
+			name:       "no matches",
+			query:      "?title=frozen",
+			wantStatus: http.StatusOK,
+			wantTitles: []string{},
+		},
+		{
+			name:       "invalid sort",
+			query:      "?sort=rating",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []string{"sort"},
+		},
+		{
+			name:       "invalid page",
+			query:      "?page=0&page_size=abc",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []string{"page", "page_size"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodGet, "/v1/movies"+tt.query).do().
+				expectStatus(tt.wantStatus)
+
+			if tt.wantErrors != nil {
+				res.expectErrorKeys(tt.wantErrors...)
+				return
+			}
+
+			var env struct {
+				Metadata struct {
+					LastPage     int `json:"last_page"`
+					TotalRecords int `json:"total_records"`
+				} `json:"metadata"`
+				Movies []testMovie `json:"movies"`
+			}
+			res.decode(&env)
+
+			titles := []string{}
+			for _, m := range env.Movies {
+				titles = append(titles, m.Title)
+			}
+			if fmt.Sprint(titles) != fmt.Sprint(tt.wantTitles) {
+				t.Errorf("got titles %v; want %v", titles, tt.wantTitles)
+			}
+			if env.Metadata.TotalRecords != tt.wantTotal {
+				t.Errorf("got total_records %d; want %d", env.Metadata.TotalRecords, tt.wantTotal)
+			}
+			if tt.wantLastPag != 0 && env.Metadata.LastPage != tt.wantLastPag {
+				t.Errorf("got last_page %d; want %d", env.Metadata.LastPage, tt.wantLastPag)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jahidhimon/greenlight.git/internal/i18n"
+	"github.com/jahidhimon/greenlight.git/internal/validator"
+)
+
+// problemTypeBase is the prefix of the type URIs in problem+json responses.
+const problemTypeBase = "https://greenlight.jahid.net/problems/"
+
+// problemType is a kind of error, identified in RFC 7807 problem+json
+// responses by a type URI, so that clients can tell errors apart without
+// matching on the message. The zero problemType stands for "about:blank",
+// meaning there's nothing more to say about the error than its status code.
+type problemType struct {
+	slug  string
+	title string
+}
+
+var (
+	problemBadRequest             = problemType{"bad-request", "The request couldn't be read"}
+	problemValidationFailed       = problemType{"validation-failed", "The request has invalid parameters"}
+	problemServerError            = problemType{"server-error", "Internal server error"}
+	problemNotFound               = problemType{"not-found", "Resource not found"}
+	problemMethodNotAllowed       = problemType{"method-not-allowed", "Method not allowed"}
+	problemEditConflict           = problemType{"edit-conflict", "Edit conflict"}
+	problemRateLimited            = problemType{"rate-limited", "Rate limit exceeded"}
+	problemInvalidCredentials     = problemType{"invalid-credentials", "Invalid credentials"}
+	problemInvalidToken           = problemType{"invalid-token", "Invalid authentication token"}
+	problemAuthenticationRequired = problemType{"authentication-required", "Authentication required"}
+	problemInactiveAccount        = problemType{"inactive-account", "Inactive account"}
+	problemNotPermitted           = problemType{"not-permitted", "Not permitted"}
+)
+
+func (p problemType) uri() string {
+	if p.slug == "" {
+		return "about:blank"
+	}
+	return problemTypeBase + p.slug
+}
+
+// invalidParam is an entry in the invalid-params extension member, which
+// lists the fields that failed validation. Code is the machine-readable name
+// of the rule the field broke, when it's known.
+type invalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+	Code   string `json:"code,omitempty"`
+}
+
+// wantsProblemJSON reports whether the client listed
+// application/problem+json in its Accept header.
+func wantsProblemJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil || mediaType != "application/problem+json" {
+				continue
+			}
+			// q=0 means the client doesn't want it.
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// writeProblem sends message, which has already been translated into locale,
+// as a problem details object. The instance member is the request ID, which
+// matches the X-Request-ID header and the request_id in the logs.
+func (app *application) writeProblem(w http.ResponseWriter, r *http.Request, status int,
+	kind problemType, locale string, message interface{}) error {
+	title := http.StatusText(status)
+	if kind.slug != "" {
+		title = i18n.Translate(locale, kind.title)
+	}
+
+	problem := envelope{
+		"type":   kind.uri(),
+		"title":  title,
+		"status": status,
+	}
+	if id := app.contextGetRequestID(r); id != "" {
+		problem["instance"] = id
+	}
+
+	switch m := message.(type) {
+	case string:
+		problem["detail"] = m
+	case map[string]string:
+		problem["detail"] = i18n.Translate(locale, "one or more fields are invalid")
+
+		params := make([]invalidParam, 0, len(m))
+		for name, reason := range m {
+			params = append(params, invalidParam{Name: name, Reason: reason})
+		}
+		sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+		problem["invalid-params"] = params
+	case *validator.Validator:
+		problem["detail"] = i18n.Translate(locale, "one or more fields are invalid")
+
+		// Every error is listed, in the order the fields were checked, so a
+		// field can appear more than once.
+		params := make([]invalidParam, 0, len(m.Details))
+		for _, e := range m.Details {
+			params = append(params, invalidParam{Name: e.Key, Reason: e.Message, Code: e.Code})
+		}
+		problem["invalid-params"] = params
+	}
+
+	headers := http.Header{"Content-Type": {"application/problem+json"}}
+	return app.writeJSON(w, status, problem, headers)
+}
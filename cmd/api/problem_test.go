@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testProblem mirrors a problem+json response.
+type testProblem struct {
+	Type          string `json:"type"`
+	Title         string `json:"title"`
+	Status        int    `json:"status"`
+	Detail        string `json:"detail"`
+	Instance      string `json:"instance"`
+	InvalidParams []struct {
+		Name   string `json:"name"`
+		Reason string `json:"reason"`
+		Code   string `json:"code"`
+	} `json:"invalid-params"`
+}
+
+func TestProblemDetails(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	// Clients which don't ask for problem+json keep getting the old format.
+	ts.request(t, http.MethodGet, "/v1/movies/999").do().
+		expectStatus(http.StatusNotFound).
+		expectHeader("Content-Type", "application/json")
+
+	var p testProblem
+	res := ts.request(t, http.MethodGet, "/v1/movies/999").
+		withHeader("Accept", "application/json, application/problem+json;q=0.9").do().
+		expectStatus(http.StatusNotFound).
+		expectHeader("Content-Type", "application/problem+json").
+		decode(&p)
+	if p.Type != problemTypeBase+"not-found" || p.Title != "Resource not found" || p.Status != http.StatusNotFound {
+		t.Errorf("got %+v", p)
+	}
+	if p.Detail != "The requested resource could not be found" {
+		t.Errorf("got detail %q", p.Detail)
+	}
+	if id := res.Header.Get("X-Request-ID"); id == "" || p.Instance != id {
+		t.Errorf("got instance %q; want the X-Request-ID %q", p.Instance, id)
+	}
+
+	ts.request(t, http.MethodGet, "/v1/movies/999").
+		withHeader("Accept", "application/problem+json;q=0").do().
+		expectHeader("Content-Type", "application/json")
+
+	p = testProblem{}
+	ts.request(t, http.MethodPost, "/v1/movies").
+		withHeader("Accept", "application/problem+json").
+		withHeader("Accept-Language", "es").
+		withHeader("X-Request-ID", "abc-123").
+		withJSON(map[string]interface{}{"title": "", "year": 1800, "runtime": "90 mins", "genres": []string{"drama"}}).do().
+		expectStatus(http.StatusUnprocessableEntity).
+		expectHeader("X-Request-ID", "abc-123").
+		decode(&p)
+	if p.Type != problemTypeBase+"validation-failed" || p.Instance != "abc-123" {
+		t.Errorf("got %+v", p)
+	}
+	if len(p.InvalidParams) != 2 || p.InvalidParams[0].Name != "title" || p.InvalidParams[1].Name != "year" {
+		t.Fatalf("got invalid-params %+v; want title and year", p.InvalidParams)
+	}
+	if p.InvalidParams[0].Reason != "es obligatorio" || p.InvalidParams[0].Code != "required" {
+		t.Errorf("got %+v", p.InvalidParams[0])
+	}
+	if p.InvalidParams[1].Code != "min" {
+		t.Errorf("got %+v", p.InvalidParams[1])
+	}
+
+	// Each broken rule is listed, with indexed keys for elements.
+	p = testProblem{}
+	ts.request(t, http.MethodPost, "/v1/movies").
+		withHeader("Accept", "application/problem+json").
+		withJSON(map[string]interface{}{"title": "Up", "year": 2009, "runtime": "96 mins",
+			"genres": []string{"a", "b", "c", "d", "a", ""}}).do().
+		expectStatus(http.StatusUnprocessableEntity).
+		decode(&p)
+	var got []string
+	for _, param := range p.InvalidParams {
+		got = append(got, param.Name+":"+param.Code)
+	}
+	if want := "genres:max genres:unique genres[5]:required"; strings.Join(got, " ") != want {
+		t.Errorf("got invalid-params %v; want %s", got, want)
+	}
+}
+
+func TestProblemDetailsFlag(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.problemDetails = true
+	ts := newTestServer(t, app)
+
+	var p testProblem
+	ts.request(t, http.MethodDelete, "/v1/healthcheck").do().
+		expectStatus(http.StatusMethodNotAllowed).
+		expectHeader("Content-Type", "application/problem+json").
+		decode(&p)
+	if p.Type != problemTypeBase+"method-not-allowed" {
+		t.Errorf("got type %q", p.Type)
+	}
+
+	// Errors without a more specific type fall back to about:blank.
+	p = testProblem{}
+	ts.request(t, http.MethodOptions, "/v1/movies").
+		withHeader("Origin", "https://evil.example.com").
+		withHeader("Access-Control-Request-Method", http.MethodPost).do().
+		expectStatus(http.StatusForbidden).
+		decode(&p)
+	if p.Type != "about:blank" || p.Title != "Forbidden" {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	first := ts.request(t, http.MethodGet, "/v1/healthcheck").do().Header.Get("X-Request-ID")
+	second := ts.request(t, http.MethodGet, "/v1/healthcheck").do().Header.Get("X-Request-ID")
+	if first == "" || first == second {
+		t.Errorf("got request IDs %q and %q; want two different IDs", first, second)
+	}
+
+	// IDs which aren't safe to log are replaced.
+	got := ts.request(t, http.MethodGet, "/v1/healthcheck").withHeader("X-Request-ID", "bad id!").do().
+		Header.Get("X-Request-ID")
+	if got == "" || got == "bad id!" {
+		t.Errorf("got request ID %q", got)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+	"github.com/jahidhimon/greenlight.git/internal/mailer"
+)
+
+// reloadableConfig mirrors the subset of config that can be changed while the
+// server is running. Every field is a pointer so that we can tell the
+// difference between a setting that is missing from the file (keep the
+// current value) and one that is explicitly set to its zero value.
+type reloadableConfig struct {
+	LogLevel *string `json:"log_level"`
+	Limiter  *struct {
+		RPS     *float64 `json:"rps"`
+		Burst   *int     `json:"burst"`
+		Enabled *bool    `json:"enabled"`
+		// Tiers and APIKeys use the same "name=rps:burst" and "key=tier"
+		// formats as the command line flags.
+		Tiers          *[]string `json:"tiers"`
+		APIKeys        *[]string `json:"api_keys"`
+		TrustedProxies *[]string `json:"trusted_proxies"`
+	} `json:"limiter"`
+	SMTP *struct {
+		Host     *string `json:"host"`
+		Port     *int    `json:"port"`
+		Username *string `json:"username"`
+		Password *string `json:"password"`
+		Sender   *string `json:"sender"`
+	} `json:"smtp"`
+	CORS *struct {
+		TrustedOrigins *[]string `json:"trusted_origins"`
+	} `json:"cors"`
+
+	// Parsed forms of the limiter lists, filled in by parse().
+	tiers          map[string]limiterTier
+	apiKeys        map[string]string
+	trustedProxies []*net.IPNet
+}
+
+func readReloadableConfig(path string) (*reloadableConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rc reloadableConfig
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rc); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	if err := rc.parse(); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return &rc, nil
+}
+
+// parse checks the settings that need more than JSON decoding, and converts
+// the limiter lists into the form used by limiterConfig.
+func (rc *reloadableConfig) parse() error {
+	if rc.LogLevel != nil {
+		if _, err := greenlog.ParseLevel(*rc.LogLevel); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if l := rc.Limiter; l != nil {
+		if l.Tiers != nil {
+			rc.tiers, err = parseLimiterTiers(strings.Join(*l.Tiers, " "))
+			if err != nil {
+				return err
+			}
+		}
+		if l.APIKeys != nil {
+			rc.apiKeys, err = parseAPIKeys(strings.Join(*l.APIKeys, " "))
+			if err != nil {
+				return err
+			}
+		}
+		if l.TrustedProxies != nil {
+			rc.trustedProxies, err = parseTrustedProxies(*l.TrustedProxies)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// apply copies every setting present in the file over the matching field of
+// cfg.
+func (rc *reloadableConfig) apply(cfg *config) {
+	if rc.LogLevel != nil {
+		cfg.logLevel = *rc.LogLevel
+	}
+	if l := rc.Limiter; l != nil {
+		if l.RPS != nil {
+			cfg.limiter.rps = *l.RPS
+		}
+		if l.Burst != nil {
+			cfg.limiter.burst = *l.Burst
+		}
+		if l.Enabled != nil {
+			cfg.limiter.enabled = *l.Enabled
+		}
+		if l.Tiers != nil {
+			cfg.limiter.tiers = rc.tiers
+		}
+		if l.APIKeys != nil {
+			cfg.limiter.apiKeys = rc.apiKeys
+		}
+		if l.TrustedProxies != nil {
+			cfg.limiter.trustedProxies = rc.trustedProxies
+		}
+	}
+	if s := rc.SMTP; s != nil {
+		if s.Host != nil {
+			cfg.smtp.host = *s.Host
+		}
+		if s.Port != nil {
+			cfg.smtp.port = *s.Port
+		}
+		if s.Username != nil {
+			cfg.smtp.username = *s.Username
+		}
+		if s.Password != nil {
+			cfg.smtp.password = *s.Password
+		}
+		if s.Sender != nil {
+			cfg.smtp.sender = *s.Sender
+		}
+	}
+	if c := rc.CORS; c != nil && c.TrustedOrigins != nil {
+		cfg.cors.trustedOrigins = *c.TrustedOrigins
+	}
+}
+
+// reloadConfig re-reads the -config file and swaps in the new limiter, log
+// level, SMTP and CORS settings. Either all of the new settings are applied
+// or, if the file can't be read, none of them are.
+func (app *application) reloadConfig() error {
+	if app.config.configFile == "" {
+		return fmt.Errorf("no -config file to reload from")
+	}
+
+	rc, err := readReloadableConfig(app.config.configFile)
+	if err != nil {
+		return err
+	}
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	old := app.config
+	next := app.config
+	rc.apply(&next)
+
+	level, err := greenlog.ParseLevel(next.logLevel)
+	if err != nil {
+		return err
+	}
+
+	nextMailer := app.mailer
+	if next.smtp != old.smtp {
+		nextMailer, err = newMailer(next, app.logger)
+		if err != nil {
+			return err
+		}
+	}
+
+	app.config.logLevel = next.logLevel
+	app.config.limiter = next.limiter
+	app.config.cors = next.cors
+	app.config.smtp = next.smtp
+	app.mailer = nextMailer
+	app.logger.SetLevel(level)
+
+	app.logger.PrintInfo("configuration reloaded", configChanges(old, next))
+	return nil
+}
+
+// configChanges returns a description of every reloadable setting that differs
+// between old and next, suitable for passing to the logger as properties.
+// The SMTP password and API keys are never logged.
+func configChanges(old, next config) map[string]string {
+	changes := make(map[string]string)
+	diff := func(key, from, to string) {
+		if from != to {
+			changes[key] = from + " -> " + to
+		}
+	}
+
+	diff("log_level", old.logLevel, next.logLevel)
+	diff("limiter.rps", strconv.FormatFloat(old.limiter.rps, 'g', -1, 64),
+		strconv.FormatFloat(next.limiter.rps, 'g', -1, 64))
+	diff("limiter.burst", strconv.Itoa(old.limiter.burst), strconv.Itoa(next.limiter.burst))
+	diff("limiter.enabled", strconv.FormatBool(old.limiter.enabled),
+		strconv.FormatBool(next.limiter.enabled))
+	diff("limiter.tiers", formatLimiterTiers(old.limiter.tiers),
+		formatLimiterTiers(next.limiter.tiers))
+	diff("limiter.api_keys", strconv.Itoa(len(old.limiter.apiKeys))+" keys",
+		strconv.Itoa(len(next.limiter.apiKeys))+" keys")
+	diff("limiter.trusted_proxies", formatIPNets(old.limiter.trustedProxies),
+		formatIPNets(next.limiter.trustedProxies))
+	diff("smtp.host", old.smtp.host, next.smtp.host)
+	diff("smtp.port", strconv.Itoa(old.smtp.port), strconv.Itoa(next.smtp.port))
+	diff("smtp.username", old.smtp.username, next.smtp.username)
+	diff("smtp.sender", old.smtp.sender, next.smtp.sender)
+	if old.smtp.password != next.smtp.password {
+		changes["smtp.password"] = "changed"
+	}
+	diff("cors.trusted_origins", strings.Join(old.cors.trustedOrigins, " "),
+		strings.Join(next.cors.trustedOrigins, " "))
+
+	return changes
+}
+
+func formatIPNets(nets []*net.IPNet) string {
+	s := make([]string, len(nets))
+	for i, n := range nets {
+		s[i] = n.String()
+	}
+	return strings.Join(s, " ")
+}
+
+// currentLimiterConfig returns the current rate limiter settings. A reload
+// replaces the maps and slices rather than modifying them, so the copy is
+// safe to use after the lock is released.
+func (app *application) currentLimiterConfig() limiterConfig {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.config.limiter
+}
+
+// trustedOrigins returns the current list of trusted CORS origins.
+func (app *application) trustedOrigins() []string {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.config.cors.trustedOrigins
+}
+
+// currentMailer returns the mailer built from the current SMTP settings.
+func (app *application) currentMailer() mailer.Mailer {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.mailer
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+)
+
+// replicaCheckInterval is how often the read replica is pinged. A replica
+// which fails a query is taken out of use straight away, so this only decides
+// how soon it is put back.
+const replicaCheckInterval = 5 * time.Second
+
+// monitorReplica checks the replica's health every replicaCheckInterval, for
+// ever, and logs the result of the first check and of every check which finds
+// the replica in a different state from the one before.
+func monitorReplica(replica *data.Replica, logger *greenlog.Greenlog) {
+	var lastErr error
+
+	for first := true; ; first = false {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaCheckInterval)
+		err := replica.Check(ctx)
+		cancel()
+
+		switch {
+		case err != nil && (first || lastErr == nil):
+			logger.Warn("read replica is unhealthy, reading movies from the primary", greenlog.Err(err))
+		case err == nil && (first || lastErr != nil):
+			logger.PrintInfo("read replica is healthy, reading movies from it", nil)
+		}
+		lastErr = err
+
+		time.Sleep(replicaCheckInterval)
+	}
+}
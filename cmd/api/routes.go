@@ -16,10 +16,15 @@ func (app *application) routes() http.Handler {
 	// Convert methodNotAllowedResponse helper to http handlerFunc and set
 	// it as the custom error handler for 405 method not allowed
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+
+	// Answer CORS preflight requests. httprouter fills in the Allow header
+	// with the methods registered for the path before calling this.
+	router.GlobalOPTIONS = http.HandlerFunc(app.preflightHandler)
 	
 	// Register the relevant methods, URL patterns and handler functions for
 	// endpoints using HandlerFunc() method.
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/metrics", app.requirePermission("admin", app.metricsHandler))
 	
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.listMovieHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/movies", app.createMovieHandler)
@@ -28,7 +33,20 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.deleteMovieHandler)
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/jobs", app.requirePermission("admin", app.listJobsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/jobs/:id", app.requirePermission("admin", app.showJobHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/jobs/:id/retry", app.requirePermission("admin", app.retryJobHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/emails/:template/preview", app.requirePermission("admin", app.previewEmailHandler))
 
-	return app.recoverPanic(app.rateLimit(router))
+	// The compression middleware sits outside recoverPanic so that the error
+	// response written after a panic is compressed along with everything else.
+	// Requests are authenticated before rate limiting so that each user gets
+	// their own budget; authenticate charges bad tokens to the client IP. The
+	// request ID comes first so that every error response and log entry can
+	// include it, after only the trace span, which times the whole request
+	// and gives the logs its trace ID.
+	return app.traceRequest(app.requestID(app.compressResponse(app.recoverPanic(app.enableCORS(app.authenticate(app.rateLimit(router)))))))
 }
 
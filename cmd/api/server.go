@@ -7,8 +7,11 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
 )
 
 func (app *application) serve() error {
@@ -18,18 +21,62 @@ func (app *application) serve() error {
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		// net/http logs problems such as failed TLS handshakes, which are
+		// usually the client's fault, so they're warnings rather than errors.
+		ErrorLog: app.logger.StdLogger(greenlog.LevelWarn),
+	}
+
+	// If a certificate and key have been given, serve HTTPS (and HTTP/2)
+	// instead of plain HTTP, optionally redirecting a plain HTTP port to it.
+	useTLS := app.config.tls.certFile != "" && app.config.tls.keyFile != ""
+	var redirectSrv *http.Server
+	if useTLS {
+		cr, err := newCertReloader(app.config.tls.certFile, app.config.tls.keyFile, app.logger)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = newTLSConfig(cr)
+
+		if app.config.tls.redirectPort != 0 {
+			redirectSrv = app.redirectToHTTPS()
+		}
 	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	app.startJobWorkers(jobsCtx)
+
 	shutdownError := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
-		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+		// SIGHUP reloads the runtime configuration and keeps on serving;
+		// any other signal falls through to a graceful shutdown.
 		s := <-quit
+		for s == syscall.SIGHUP {
+			err := app.reloadConfig()
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{
+					"signal": s.String(),
+				})
+			}
+			s = <-quit
+		}
 
 		app.logger.PrintInfo("shutting down server", map[string]string{
 			"signal": s.String(),
 		})
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
+		if redirectSrv != nil {
+			err := redirectSrv.Shutdown(ctx)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{
+					"addr": redirectSrv.Addr,
+				})
+			}
+		}
 		err := srv.Shutdown(ctx)
 		if err != nil {
 			shutdownError <- err
@@ -37,16 +84,40 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
+		// Job workers finish the job they are running and stop.
+		stopJobs()
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
 
+	if redirectSrv != nil {
+		go func() {
+			app.logger.PrintInfo("starting HTTPS redirect server", map[string]string{
+				"addr": redirectSrv.Addr,
+			})
+			err := redirectSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err, map[string]string{
+					"addr": redirectSrv.Addr,
+				})
+			}
+		}()
+	}
+
 	app.logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
 		"env":  app.config.env,
+		"tls":  strconv.FormatBool(useTLS),
 	})
 
-	err := srv.ListenAndServe()
+	var err error
+	if useTLS {
+		// The certificate comes from TLSConfig.GetCertificate, so there
+		// are no file names to pass here.
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+	"github.com/jahidhimon/greenlight.git/internal/mailer"
+)
+
+// newTestApplication returns an application backed by the in-memory data
+// backend, with the rate limiter switched off and logs thrown away. Tests
+// change app.config before calling newTestServer if they need to.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	app := &application{
+		logger: greenlog.New(io.Discard, greenlog.LevelInfo),
+		models: data.NewMemoryModels(),
+	}
+	app.limiter = newMemoryLimiterStore(app.limiterStaleAge)
+	captureMail(t, app)
+	app.config.env = "testing"
+	app.config.limiter = limiterConfig{rps: 2, burst: 4, enabled: false}
+	// No job workers are started, so tests run queued jobs themselves
+	// with runNextJob.
+	app.config.jobs.maxAttempts = 3
+
+	return app
+}
+
+// captureMail makes the application send emails to a capture transport, and
+// returns the transport so the test can see what was sent.
+func captureMail(t *testing.T, app *application) *mailer.CaptureTransport {
+	t.Helper()
+
+	capture := mailer.NewCaptureTransport()
+	m, err := mailer.New(capture, "Greenlight <no-reply@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.mailer = m
+	return capture
+}
+
+// testServer runs an application's routes on an httptest.Server.
+type testServer struct {
+	*httptest.Server
+	app *application
+}
+
+func newTestServer(t *testing.T, app *application) *testServer {
+	t.Helper()
+
+	ts := httptest.NewServer(app.routes())
+	t.Cleanup(func() {
+		ts.Close()
+		// Let background tasks finish before the next test starts.
+		app.wg.Wait()
+	})
+
+	return &testServer{Server: ts, app: app}
+}
+
+// testRequest builds up a request to the test server. Calls can be chained:
+//
+//	ts.request(t, http.MethodPost, "/v1/movies").withJSON(input).do().expectStatus(http.StatusOK)
+type testRequest struct {
+	t      *testing.T
+	ts     *testServer
+	method string
+	path   string
+	body   io.Reader
+	header http.Header
+}
+
+func (ts *testServer) request(t *testing.T, method, path string) *testRequest {
+	return &testRequest{
+		t:      t,
+		ts:     ts,
+		method: method,
+		path:   path,
+		header: make(http.Header),
+	}
+}
+
+func (r *testRequest) withHeader(key, value string) *testRequest {
+	r.header.Set(key, value)
+	return r
+}
+
+// withAPIKey sends the request with an X-API-Key header, which the rate
+// limiter uses to identify the client.
+func (r *testRequest) withAPIKey(key string) *testRequest {
+	return r.withHeader("X-API-Key", key)
+}
+
+// withToken sends the request with a bearer authentication token.
+func (r *testRequest) withToken(token string) *testRequest {
+	return r.withHeader("Authorization", "Bearer "+token)
+}
+
+// withJSON sets the request body. Strings are sent as they are, so that tests
+// can send malformed JSON; anything else is encoded.
+func (r *testRequest) withJSON(body interface{}) *testRequest {
+	r.t.Helper()
+
+	switch b := body.(type) {
+	case string:
+		r.body = bytes.NewBufferString(b)
+	default:
+		js, err := json.Marshal(b)
+		if err != nil {
+			r.t.Fatal(err)
+		}
+		r.body = bytes.NewBuffer(js)
+	}
+	r.header.Set("Content-Type", "application/json")
+	return r
+}
+
+func (r *testRequest) do() *testResponse {
+	r.t.Helper()
+
+	req, err := http.NewRequest(r.method, r.ts.URL+r.path, r.body)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	req.Header = r.header
+
+	res, err := r.ts.Client().Do(req)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	return &testResponse{t: r.t, Response: res, body: body}
+}
+
+// testResponse is a response which has been read in full.
+type testResponse struct {
+	t *testing.T
+	*http.Response
+	body []byte
+}
+
+func (r *testResponse) expectStatus(status int) *testResponse {
+	r.t.Helper()
+
+	if r.StatusCode != status {
+		r.t.Fatalf("got status %d; want %d\nbody: %s", r.StatusCode, status, r.body)
+	}
+	return r
+}
+
+func (r *testResponse) expectHeader(key, value string) *testResponse {
+	r.t.Helper()
+
+	if got := r.Header.Get(key); got != value {
+		r.t.Fatalf("got %s header %q; want %q", key, got, value)
+	}
+	return r
+}
+
+// decode unmarshals the response body into dst.
+func (r *testResponse) decode(dst interface{}) *testResponse {
+	r.t.Helper()
+
+	if err := json.Unmarshal(r.body, dst); err != nil {
+		r.t.Fatalf("decoding response: %v\nbody: %s", err, r.body)
+	}
+	return r
+}
+
+// expectErrorKeys checks that the response is a failed validation response
+// with an error for each of the given keys.
+func (r *testResponse) expectErrorKeys(keys ...string) *testResponse {
+	r.t.Helper()
+
+	var env struct {
+		Error map[string]string `json:"error"`
+	}
+	r.decode(&env)
+
+	for _, key := range keys {
+		if _, ok := env.Error[key]; !ok {
+			r.t.Fatalf("no error for %q in %v", key, env.Error)
+		}
+	}
+	return r
+}
+
+// testMovie mirrors the JSON representation of data.Movie.
+type testMovie struct {
+	ID      int64    `json:"id"`
+	Title   string   `json:"title"`
+	Year    int32    `json:"year"`
+	Runtime string   `json:"runtime"`
+	Genres  []string `json:"genre"`
+	Version int32    `json:"version"`
+}
+
+// createMovie adds a movie through the API and returns it.
+func (ts *testServer) createMovie(t *testing.T, title string, year int32, runtime int, genres ...string) testMovie {
+	t.Helper()
+
+	input := map[string]interface{}{
+		"title":   title,
+		"year":    year,
+		"runtime": strconv.Itoa(runtime) + " mins",
+		"genres":  genres,
+	}
+
+	var env struct {
+		Movie testMovie `json:"movie"`
+	}
+	ts.request(t, http.MethodPost, "/v1/movies").withJSON(input).do().
+		expectStatus(http.StatusOK).decode(&env)
+	return env.Movie
+}
+
+// testUser mirrors the JSON representation of data.User.
+type testUser struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Activated bool   `json:"activated"`
+}
+
+// registerUser signs a user up through the API and returns it.
+func (ts *testServer) registerUser(t *testing.T, name, email, password string) testUser {
+	t.Helper()
+
+	input := map[string]string{
+		"name":     name,
+		"email":    email,
+		"password": password,
+	}
+
+	var env struct {
+		User testUser `json:"created_user"`
+	}
+	ts.request(t, http.MethodPost, "/v1/users").withJSON(input).do().
+		expectStatus(http.StatusCreated).decode(&env)
+	return env.User
+}
+
+// authenticate logs a user in through the API and returns their
+// authentication token.
+func (ts *testServer) authenticate(t *testing.T, email, password string) string {
+	t.Helper()
+
+	input := map[string]string{
+		"email":    email,
+		"password": password,
+	}
+
+	var env struct {
+		Token struct {
+			Token string `json:"token"`
+		} `json:"authentication_token"`
+	}
+	ts.request(t, http.MethodPost, "/v1/tokens/authentication").withJSON(input).do().
+		expectStatus(http.StatusCreated).decode(&env)
+	return env.Token.Token
+}
+
+// registerAdmin signs up an activated user with the admin permission and
+// returns their authentication token.
+func (ts *testServer) registerAdmin(t *testing.T, name, email, password string) string {
+	t.Helper()
+
+	ctx := context.Background()
+	created := ts.registerUser(t, name, email, password)
+
+	user, err := ts.app.models.Users.Get(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Activated = true
+	if err := ts.app.models.Users.Update(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.app.models.Permissions.AddForUser(ctx, user.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	return ts.authenticate(t, email, password)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+)
+
+// certReloader serves the certificate and key from the -tls-cert and -tls-key
+// files, loading them again whenever either file changes on disk so that a
+// renewed certificate is picked up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *greenlog.Greenlog
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logger *greenlog.Greenlog) (*certReloader, error) {
+	cr := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+
+	// Fail at startup, rather than on the first handshake, if the files
+	// are missing or don't match.
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			time.Sleep(10 * time.Second)
+			changed, err := cr.changed()
+			if err != nil {
+				logger.PrintError(err, nil)
+				continue
+			}
+			if !changed {
+				continue
+			}
+			// Keep serving the old certificate if the new one is
+			// broken, for example because only one of the two files
+			// has been replaced so far.
+			if err := cr.reload(); err != nil {
+				logger.PrintError(err, nil)
+				continue
+			}
+			logger.PrintInfo("TLS certificate reloaded", map[string]string{
+				"cert": certFile,
+			})
+		}
+	}()
+
+	return cr, nil
+}
+
+// latestModTime returns the most recent modification time of the certificate
+// and key files.
+func (cr *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (cr *certReloader) changed() (bool, error) {
+	modTime, err := cr.latestModTime()
+	if err != nil {
+		return false, err
+	}
+
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return !modTime.Equal(cr.modTime), nil
+}
+
+func (cr *certReloader) reload() error {
+	modTime, err := cr.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.cert = &cert
+	cr.modTime = modTime
+	return nil
+}
+
+// GetCertificate is used as the tls.Config.GetCertificate callback.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// newTLSConfig returns a TLS configuration limited to TLS 1.2 and above, with
+// forward secret AEAD cipher suites only. The "h2" protocol is advertised so
+// that clients can use HTTP/2.
+func newTLSConfig(cr *certReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		// The cipher suites only apply to TLS 1.2; Go picks safe suites
+		// for TLS 1.3 itself.
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		},
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: cr.GetCertificate,
+	}
+}
+
+// redirectToHTTPS returns a server for the -tls-redirect-port which sends
+// every request on to the same path on the HTTPS port.
+func (app *application) redirectToHTTPS() *http.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			// The Host header didn't include a port. An IPv6 address is
+			// still in brackets, which JoinHostPort would add again.
+			host = strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		}
+
+		addr := net.JoinHostPort(host, strconv.Itoa(app.config.port))
+		if app.config.port == 443 {
+			// Leave out the default port, but not the brackets around an
+			// IPv6 address.
+			addr = strings.TrimSuffix(addr, ":443")
+		}
+		target := "https://" + addr + r.URL.RequestURI()
+
+		// Use 308 rather than 301 so that clients repeat the request with
+		// the same method and body.
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+
+	return &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.tls.redirectPort),
+		Handler:      handler,
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		ErrorLog:     app.logger.StdLogger(greenlog.LevelWarn),
+	}
+}
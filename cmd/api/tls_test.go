@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		host string
+		port int
+		want string
+	}{
+		{"example.com", 4000, "https://example.com:4000/v1/movies?page=2"},
+		{"example.com:80", 4000, "https://example.com:4000/v1/movies?page=2"},
+		{"example.com:80", 443, "https://example.com/v1/movies?page=2"},
+		{"[::1]", 4000, "https://[::1]:4000/v1/movies?page=2"},
+		{"[::1]:80", 4000, "https://[::1]:4000/v1/movies?page=2"},
+		{"[::1]", 443, "https://[::1]/v1/movies?page=2"},
+		{"[::1]:80", 443, "https://[::1]/v1/movies?page=2"},
+	}
+
+	for _, tt := range tests {
+		app := newTestApplication(t)
+		app.config.port = tt.port
+
+		r := httptest.NewRequest(http.MethodPost, "/v1/movies?page=2", nil)
+		r.Host = tt.host
+		rr := httptest.NewRecorder()
+		app.redirectToHTTPS().Handler.ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusPermanentRedirect {
+			t.Errorf("host %q, port %d: got status %d; want %d", tt.host, tt.port, rr.Code, http.StatusPermanentRedirect)
+		}
+		if got := rr.Header().Get("Location"); got != tt.want {
+			t.Errorf("host %q, port %d: got Location %q; want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
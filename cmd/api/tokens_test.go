@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCreateAuthenticationTokenHandler(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+	ts.registerUser(t, "Alice", "alice@example.com", "pa55word1234")
+
+	tests := []struct {
+		name       string
+		body       interface{}
+		wantStatus int
+		wantErrors []string
+	}{
+		{
+			name:       "valid",
+			body:       map[string]string{"email": "alice@example.com", "password": "pa55word1234"},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "wrong password",
+			body:       map[string]string{"email": "alice@example.com", "password": "wrongpassword"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown email",
+			body:       map[string]string{"email": "bob@example.com", "password": "pa55word1234"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid fields",
+			body:       map[string]string{"email": "not-an-email", "password": ""},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []string{"email", "password"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/tokens/authentication").withJSON(tt.body).do().
+				expectStatus(tt.wantStatus)
+
+			if tt.wantErrors != nil {
+				res.expectErrorKeys(tt.wantErrors...)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+
+	ts.request(t, http.MethodGet, "/v1/healthcheck").withToken("not-a-real-token").do().
+		expectStatus(http.StatusUnauthorized).
+		expectHeader("WWW-Authenticate", "Bearer")
+
+	ts.request(t, http.MethodGet, "/v1/healthcheck").withToken("ABCDEFGHIJKLMNOPQRSTUVWXYZ").do().
+		expectStatus(http.StatusUnauthorized)
+
+	ts.request(t, http.MethodGet, "/v1/healthcheck").withHeader("Authorization", "Basic abc").do().
+		expectStatus(http.StatusUnauthorized)
+
+	ts.registerUser(t, "Alice", "alice@example.com", "pa55word1234")
+	token := ts.authenticate(t, "alice@example.com", "pa55word1234")
+	ts.request(t, http.MethodGet, "/v1/healthcheck").withToken(token).do().
+		expectStatus(http.StatusOK)
+}
+
+func TestAuthenticateRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.limiter = limiterConfig{rps: 0.1, burst: 2, enabled: true}
+	ts := newTestServer(t, app)
+
+	// Bad tokens never reach rateLimit, but still use up the client IP's
+	// budget.
+	for i := 0; i < 2; i++ {
+		ts.request(t, http.MethodGet, "/v1/healthcheck").withToken("ABCDEFGHIJKLMNOPQRSTUVWXYZ").do().
+			expectStatus(http.StatusUnauthorized)
+	}
+	ts.request(t, http.MethodGet, "/v1/healthcheck").withToken("ABCDEFGHIJKLMNOPQRSTUVWXYZ").do().
+		expectStatus(http.StatusTooManyRequests)
+	ts.request(t, http.MethodGet, "/v1/healthcheck").do().
+		expectStatus(http.StatusTooManyRequests)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+	"github.com/jahidhimon/greenlight.git/internal/tracing"
+)
+
+// newTracer returns a tracer which exports spans as -trace-exporter says,
+// and a function which closes the exporter's file, if it has one. It returns
+// a nil tracer when tracing is off.
+func newTracer(cfg config, logger *greenlog.Greenlog) (*tracing.Tracer, func(), error) {
+	var exporter tracing.Exporter
+	closeExporter := func() {}
+
+	switch cfg.tracing.exporter {
+	case "none":
+		return nil, closeExporter, nil
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	case "file":
+		if err := os.MkdirAll(filepath.Dir(cfg.tracing.file), 0o755); err != nil {
+			return nil, nil, err
+		}
+		file, err := os.OpenFile(cfg.tracing.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter = tracing.NewWriterExporter(file)
+		closeExporter = func() { file.Close() }
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", cfg.tracing.exporter)
+	}
+
+	tracer := tracing.New(exporter, "greenlight", cfg.tracing.sampleRatio)
+	tracer.OnExportError(func(err error) {
+		logger.Error(err, greenlog.String("component", "tracing"))
+	})
+	return tracer, closeExporter, nil
+}
+
+// traceRequest records each request as a span. A traceparent header from the
+// client, or a proxy in front of the API, makes the span part of the
+// caller's trace.
+func (app *application) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, err := tracing.ParseTraceparent(r.Header.Get("traceparent")); err == nil {
+			ctx = tracing.ContextWithRemoteSpanContext(ctx, sc)
+		}
+
+		ctx, span := tracing.Start(ctx, "HTTP "+r.Method, tracing.KindServer)
+		defer span.End()
+		span.SetAttributes(
+			tracing.String("http.method", r.Method),
+			tracing.String("http.target", r.URL.RequestURI()),
+			tracing.String("http.user_agent", r.UserAgent()),
+		)
+
+		sw := &statusResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(tracing.Int("http.status_code", status))
+		if status >= 500 {
+			span.RecordError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+		}
+	})
+}
+
+// statusResponseWriter remembers the status code sent through it.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusResponseWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusResponseWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+func (sw *statusResponseWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sw *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// traceFields returns log fields with the IDs of the span in ctx, so that log
+// entries can be matched with traces, or nothing if ctx isn't being traced.
+func traceFields(ctx context.Context) []greenlog.Field {
+	sc := tracing.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []greenlog.Field{
+		greenlog.String("trace_id", sc.TraceID.String()),
+		greenlog.String("span_id", sc.SpanID.String()),
+	}
+}
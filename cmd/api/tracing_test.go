@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jahidhimon/greenlight.git/internal/tracing"
+)
+
+// traceSpans records spans in memory for the rest of the test.
+func traceSpans(t *testing.T) *tracing.MemoryExporter {
+	t.Helper()
+
+	exporter := &tracing.MemoryExporter{}
+	tracing.SetDefault(tracing.New(exporter, "greenlight", 1))
+	t.Cleanup(func() { tracing.SetDefault(nil) })
+	return exporter
+}
+
+func findSpan(t *testing.T, spans []tracing.SpanData, name string) tracing.SpanData {
+	t.Helper()
+
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no %q span in %+v", name, spans)
+	return tracing.SpanData{}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := traceSpans(t)
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	res := ts.request(t, http.MethodPost, "/v1/users").
+		withHeader("traceparent", traceparent).
+		withJSON(map[string]string{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234"}).do().
+		expectStatus(http.StatusCreated)
+
+	request := findSpan(t, exporter.Spans(), "HTTP POST")
+	if request.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || request.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("the request didn't carry on the caller's trace: %+v", request)
+	}
+	if request.Attributes["http.status_code"] != http.StatusCreated ||
+		request.Attributes["http.request_id"] != res.Header.Get("X-Request-ID") {
+		t.Errorf("got attributes %v", request.Attributes)
+	}
+
+	// The welcome email job was queued with the request's trace, so running
+	// it carries the trace on.
+	if ran, err := app.runNextJob(context.Background()); !ran || err != nil {
+		t.Fatalf("runNextJob() = %v, %v; want true, nil", ran, err)
+	}
+	spans := exporter.Spans()
+	job := findSpan(t, spans, "job "+jobWelcomeEmail)
+	if job.TraceID != request.TraceID || job.ParentSpanID != request.SpanID || job.Kind != tracing.KindConsumer {
+		t.Errorf("got job span %+v", job)
+	}
+	send := findSpan(t, spans, "mailer.send")
+	if send.ParentSpanID != job.SpanID || send.Attributes["mail.template"] != "user_welcome.tmpl" {
+		t.Errorf("got mailer span %+v", send)
+	}
+}
+
+func TestTracingErrors(t *testing.T) {
+	exporter := traceSpans(t)
+	ts := newTestServer(t, newTestApplication(t))
+
+	ts.request(t, http.MethodGet, "/v1/movies/999").withHeader("traceparent", "garbage").do().
+		expectStatus(http.StatusNotFound)
+
+	span := findSpan(t, exporter.Spans(), "HTTP GET")
+	if span.ParentSpanID != "" || span.Status != "ok" || span.Attributes["http.status_code"] != http.StatusNotFound {
+		t.Errorf("got %+v", span)
+	}
+}
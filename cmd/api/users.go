@@ -13,6 +13,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Locale   string `json:"locale"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -25,6 +26,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false,
+		Locale:    input.Locale,
 	}
 
 	err = user.Password.Set(input.Password)
@@ -35,35 +37,37 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 
 	v := validator.New()
 	if data.ValidateUser(v, user); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	// New users can read movies straight away. The user, the permission and
+	// the welcome email job are saved together, so a user is never left
+	// without them. The email is written in the language the user signed up
+	// in, unless they chose one.
+	err = app.models.Transaction(r.Context(), func(tx data.Models) error {
+		err := tx.Users.Insert(r.Context(), user)
+		if err != nil {
+			return err
+		}
+		err = tx.Permissions.AddForUser(r.Context(), user.ID, "movies:read")
+		if err != nil {
+			return err
+		}
+		payload := welcomeEmailPayload{UserID: user.ID, Locale: app.requestLocale(r)}
+		return app.enqueueJob(r.Context(), tx, jobWelcomeEmail, payload)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "a user with this email address already exists")
-			app.failedValidationResponse(w, r, v.Errors)
+			app.failedValidationResponse(w, r, v)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	// Call the Send() method on Mailer within a new goroutine to reduce latency
-	// passing in the user's email address,
-	// name of the template file, and the User struct containing the new user's data
-
-	app.background(func() {
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl", user)
-		if err != nil {
-			// We can't use serverErrorResponse on this becuase the request has
-			// been completed a long time ago and that does not exists now
-			app.logger.PrintError(err, nil)
-		}
-	})
-
 	err = app.writeJSON(w, http.StatusCreated, envelope{"created_user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestRegisterUserHandler(t *testing.T) {
+	ts := newTestServer(t, newTestApplication(t))
+	ts.registerUser(t, "Alice", "alice@example.com", "pa55word1234")
+
+	tests := []struct {
+		name       string
+		body       interface{}
+		wantStatus int
+		wantErrors []string
+	}{
+		{
+			name:       "valid",
+			body:       map[string]string{"name": "Bob", "email": "bob@example.com", "password": "pa55word1234"},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "duplicate email",
+			body:       map[string]string{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234"},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []string{"email"},
+		},
+		{
+			name:       "duplicate email in another case",
+			body:       map[string]string{"name": "Alice", "email": "ALICE@example.com", "password": "pa55word1234"},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []string{"email"},
+		},
+		{
+			name:       "invalid fields",
+			body:       map[string]string{"name": "", "email": "not-an-email", "password": "short"},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []string{"name", "email", "password"},
+		},
+		{
+			name:       "unknown field",
+			body:       `{"name": "Carol", "admin": true}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.request(t, http.MethodPost, "/v1/users").withJSON(tt.body).do().
+				expectStatus(tt.wantStatus)
+
+			if tt.wantErrors != nil {
+				res.expectErrorKeys(tt.wantErrors...)
+			}
+
+			if tt.wantStatus == http.StatusCreated {
+				var env struct {
+					User testUser `json:"created_user"`
+				}
+				res.decode(&env)
+				if env.User.ID == 0 || env.User.Activated {
+					t.Errorf("got %+v; want a new, unactivated user", env.User)
+				}
+
+				permissions, err := ts.app.models.Permissions.GetAllForUser(context.Background(), env.User.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !permissions.Include("movies:read") {
+					t.Errorf("got permissions %v; want movies:read", permissions)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Command greenlight-admin manages greenlight users and their permissions
+// directly in the database, using the same models as the API.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage: greenlight-admin [flags] <command> [arguments]
+
+commands:
+  list                                       list all users
+  create -name N -email E [-password P] [-activated]
+                                             create a user
+  activate <user>                            activate a user
+  deactivate <user>                          deactivate a user
+  delete <user>                              delete a user
+  reset-password [-password P] <user>        set a new password
+  permissions [<user>]                       list a user's permissions, or
+                                             every permission that exists
+  grant <user> <code>...                     grant permissions to a user
+  revoke <user> <code>...                    revoke permissions from a user
+  seed -file F                               load movies and users from a
+                                             YAML or JSON fixture file
+  seed -generate N [-rand-seed S]            insert N random movies
+
+A <user> is either a user ID or an email address. When -password isn't
+given, the password is read from the first line of standard input.
+
+flags:`
+
+type config struct {
+	dsn  string
+	json bool
+}
+
+// admin holds the dependencies shared by every command. ctx is cancelled on
+// an interrupt, which abandons whatever query is running.
+type admin struct {
+	ctx    context.Context
+	models data.Models
+	json   bool
+	in     io.Reader
+	out    io.Writer
+}
+
+func main() {
+	var cfg config
+
+	flag.StringVar(&cfg.dsn, "db-dsn", os.Getenv("GREENLIGHT_DB_DSN"), "PostgreSQL DSN")
+	flag.BoolVar(&cfg.json, "json", false, "Print output as JSON instead of a table")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := openDB(cfg.dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	a := &admin{
+		ctx:    ctx,
+		models: data.NewModels(db, nil, data.DefaultTimeouts()),
+		json:   cfg.json,
+		in:     os.Stdin,
+		out:    os.Stdout,
+	}
+
+	err = a.run(flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (a *admin) run(command string, args []string) error {
+	switch command {
+	case "list":
+		return a.listUsers(args)
+	case "create":
+		return a.createUser(args)
+	case "activate":
+		return a.setActivated(args, true)
+	case "deactivate":
+		return a.setActivated(args, false)
+	case "delete":
+		return a.deleteUser(args)
+	case "reset-password":
+		return a.resetPassword(args)
+	case "permissions":
+		return a.listPermissions(args)
+	case "grant":
+		return a.changePermissions(args, true)
+	case "revoke":
+		return a.changePermissions(args, false)
+	case "seed":
+		return a.seed(args)
+	default:
+		return fmt.Errorf("unknown command %q, run with -h for help", command)
+	}
+}
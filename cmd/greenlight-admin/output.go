@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+)
+
+func (a *admin) printUsers(users []*data.User) error {
+	if a.json {
+		return a.printJSON(users)
+	}
+
+	tw := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tEMAIL\tACTIVATED\tCREATED")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%t\t%s\n", u.ID, u.Name, u.Email, u.Activated,
+			u.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func (a *admin) printPermissions(permissions data.Permissions) error {
+	if a.json {
+		if permissions == nil {
+			permissions = data.Permissions{}
+		}
+		return a.printJSON(permissions)
+	}
+
+	for _, code := range permissions {
+		fmt.Fprintln(a.out, code)
+	}
+	return nil
+}
+
+func (a *admin) printMessage(message string) error {
+	if a.json {
+		return a.printJSON(map[string]string{"message": message})
+	}
+
+	_, err := fmt.Fprintln(a.out, message)
+	return err
+}
+
+func (a *admin) printJSON(v interface{}) error {
+	js, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = a.out.Write(append(js, '\n'))
+	return err
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+	"github.com/jahidhimon/greenlight.git/internal/validator"
+	"gopkg.in/yaml.v3"
+)
+
+// fixture is the layout of a seed file. Runtimes are given in minutes.
+type fixture struct {
+	Movies []struct {
+		Title   string   `json:"title" yaml:"title"`
+		Year    int32    `json:"year" yaml:"year"`
+		Runtime int32    `json:"runtime" yaml:"runtime"`
+		Genres  []string `json:"genres" yaml:"genres"`
+	} `json:"movies" yaml:"movies"`
+	Users []struct {
+		Name        string   `json:"name" yaml:"name"`
+		Email       string   `json:"email" yaml:"email"`
+		Password    string   `json:"password" yaml:"password"`
+		Activated   bool     `json:"activated" yaml:"activated"`
+		Permissions []string `json:"permissions" yaml:"permissions"`
+	} `json:"users" yaml:"users"`
+	// Reviews are accepted here only so that we can give a clear error,
+	// as the database has no reviews table yet.
+	Reviews []interface{} `json:"reviews" yaml:"reviews"`
+}
+
+// seedResult counts what a seed run did, for the summary at the end.
+type seedResult struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+func (a *admin) seed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := fs.String("file", "", "YAML or JSON fixture file to load")
+	generate := fs.Int("generate", 0, "Number of random movies to generate")
+	randSeed := fs.Int64("rand-seed", 0, "Seed for the random generator (default: current time)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *generate < 0 || (*file == "") == (*generate == 0) {
+		return errors.New("usage: seed -file F | seed -generate N [-rand-seed S]")
+	}
+
+	if *generate > 0 {
+		if *randSeed == 0 {
+			*randSeed = time.Now().UnixNano()
+		}
+		return a.generateMovies(*generate, rand.New(rand.NewSource(*randSeed)))
+	}
+
+	fx, err := readFixture(*file)
+	if err != nil {
+		return err
+	}
+	return a.loadFixture(fx)
+}
+
+func readFixture(name string) (*fixture, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unknown keys are rejected so that a typo in a field name doesn't
+	// silently load a record with a missing value.
+	var fx fixture
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&fx)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&fx)
+	default:
+		return nil, fmt.Errorf("%s: fixture files must end in .json, .yaml or .yml", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if len(fx.Reviews) > 0 {
+		return nil, fmt.Errorf("%s: reviews can't be seeded, there is no reviews table", name)
+	}
+	return &fx, nil
+}
+
+// loadFixture validates everything in the fixture before writing any of it,
+// then inserts or updates each record. Movies are matched on title and year
+// and users on email address, so loading the same file twice changes nothing.
+// It's all done in one transaction, so a failure part way through leaves the
+// database as it was.
+func (a *admin) loadFixture(fx *fixture) error {
+	movies := make([]*data.Movie, len(fx.Movies))
+	for i, m := range fx.Movies {
+		movies[i] = &data.Movie{
+			Title:   m.Title,
+			Year:    m.Year,
+			Runtime: data.Runtime(m.Runtime),
+			Genres:  m.Genres,
+		}
+
+		v := validator.New()
+		if data.ValidateMovie(v, movies[i]); !v.Valid() {
+			return fmt.Errorf("movie %d (%q): %w", i, m.Title, validationError(v))
+		}
+	}
+
+	users := make([]*data.User, len(fx.Users))
+	for i, u := range fx.Users {
+		users[i] = &data.User{
+			Name:      u.Name,
+			Email:     u.Email,
+			Activated: u.Activated,
+		}
+		if err := users[i].Password.Set(u.Password); err != nil {
+			return err
+		}
+
+		v := validator.New()
+		if data.ValidateUser(v, users[i]); !v.Valid() {
+			return fmt.Errorf("user %d (%q): %w", i, u.Email, validationError(v))
+		}
+	}
+
+	var movieResult, userResult seedResult
+
+	err := a.models.Transaction(a.ctx, func(tx data.Models) error {
+		// The transaction may be retried, so count from scratch each time.
+		movieResult, userResult = seedResult{}, seedResult{}
+
+		for _, movie := range movies {
+			err := a.upsertMovie(tx, movie, &movieResult)
+			if err != nil {
+				return fmt.Errorf("movie %q: %w", movie.Title, err)
+			}
+		}
+
+		for i, user := range users {
+			err := a.upsertUser(tx, user, fx.Users[i].Password, &userResult)
+			if err != nil {
+				return fmt.Errorf("user %q: %w", user.Email, err)
+			}
+
+			if len(fx.Users[i].Permissions) > 0 {
+				err = tx.Permissions.AddForUser(a.ctx, user.ID, fx.Users[i].Permissions...)
+				if err != nil {
+					return fmt.Errorf("user %q: %w", user.Email, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.printSeedResults(map[string]seedResult{
+		"movies": movieResult,
+		"users":  userResult,
+	})
+}
+
+func (a *admin) upsertMovie(models data.Models, movie *data.Movie, result *seedResult) error {
+	existing, err := models.Movies.GetByTitleAndYear(a.ctx, movie.Title, movie.Year)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			return err
+		}
+		result.Inserted++
+		return models.Movies.Insert(a.ctx, movie)
+	}
+
+	if existing.Runtime == movie.Runtime && equalStrings(existing.Genres, movie.Genres) {
+		result.Unchanged++
+		return nil
+	}
+
+	existing.Runtime = movie.Runtime
+	existing.Genres = movie.Genres
+	result.Updated++
+	return models.Movies.Update(a.ctx, existing)
+}
+
+func (a *admin) upsertUser(models data.Models, user *data.User, plaintext string, result *seedResult) error {
+	existing, err := models.Users.GetByEmail(a.ctx, user.Email)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			return err
+		}
+		result.Inserted++
+		return models.Users.Insert(a.ctx, user)
+	}
+
+	// Carry the ID over so that permissions are granted to the right user.
+	user.ID = existing.ID
+
+	matches, err := existing.Password.Matches(plaintext)
+	if err != nil {
+		return err
+	}
+	if existing.Name == user.Name && existing.Activated == user.Activated && matches {
+		result.Unchanged++
+		return nil
+	}
+
+	existing.Name = user.Name
+	existing.Activated = user.Activated
+	if !matches {
+		existing.Password = user.Password
+	}
+	result.Updated++
+	return models.Users.Update(a.ctx, existing)
+}
+
+var (
+	titleAdjectives = []string{"Silent", "Last", "Crimson", "Hidden", "Broken", "Golden",
+		"Distant", "Forgotten", "Electric", "Midnight", "Wild", "Lonely", "Burning", "Frozen"}
+	titleNouns = []string{"River", "Empire", "Horizon", "Garden", "Signal", "Kingdom",
+		"Harbor", "Shadow", "Machine", "Summer", "Station", "Frontier", "Letter", "Storm"}
+	titlePatterns = []string{"The %s %s", "%s %s", "A %s %s", "Return of the %s %s"}
+	genres        = []string{"action", "adventure", "animation", "comedy", "crime",
+		"documentary", "drama", "family", "fantasy", "horror", "mystery", "romance",
+		"sci-fi", "thriller", "western"}
+)
+
+// generateMovies inserts n random movies, for filling a database for load
+// testing. Each one goes through ValidateMovie like any other movie.
+func (a *admin) generateMovies(n int, rng *rand.Rand) error {
+	thisYear := time.Now().Year()
+
+	for i := 0; i < n; i++ {
+		movie := &data.Movie{
+			Title: fmt.Sprintf(titlePatterns[rng.Intn(len(titlePatterns))],
+				titleAdjectives[rng.Intn(len(titleAdjectives))],
+				titleNouns[rng.Intn(len(titleNouns))]),
+			Year: int32(1920 + rng.Intn(thisYear-1920+1)),
+			// Most feature films run for between 80 and 180 minutes.
+			Runtime: data.Runtime(80 + rng.Intn(101)),
+			Genres:  pickGenres(rng, 1+rng.Intn(3)),
+		}
+
+		v := validator.New()
+		if data.ValidateMovie(v, movie); !v.Valid() {
+			return fmt.Errorf("generated movie %q: %w", movie.Title, validationError(v))
+		}
+
+		err := a.models.Movies.Insert(a.ctx, movie)
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.printSeedResults(map[string]seedResult{
+		"movies": {Inserted: n},
+	})
+}
+
+// pickGenres returns n different genres in a random order.
+func pickGenres(rng *rand.Rand, n int) []string {
+	picked := make([]string, n)
+	for i, j := range rng.Perm(len(genres))[:n] {
+		picked[i] = genres[j]
+	}
+	return picked
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *admin) printSeedResults(results map[string]seedResult) error {
+	if a.json {
+		return a.printJSON(results)
+	}
+
+	kinds := make([]string, 0, len(results))
+	for kind := range results {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		r := results[kind]
+		fmt.Fprintf(a.out, "%s: %d inserted, %d updated, %d unchanged\n",
+			kind, r.Inserted, r.Updated, r.Unchanged)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+)
+
+// countMovies returns the number of movies in a's database.
+func countMovies(t *testing.T, a *admin) int {
+	t.Helper()
+
+	_, metadata, err := a.models.Movies.GetAll(context.Background(), "", nil,
+		data.Filters{Page: 1, PageSize: 100, Sort: "id", SortSafeList: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.TotalRecords
+}
+
+func writeFixture(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSeedUsage(t *testing.T) {
+	a := newTestAdmin(t)
+
+	for _, args := range [][]string{
+		{"seed"},
+		{"seed", "-generate", "-5"},
+		{"seed", "-generate", "2", "-file", "movies.yaml"},
+		{"seed", "-generate", "2", "extra"},
+	} {
+		_, err := a.runTest(t, "", args...)
+		if err == nil || !strings.HasPrefix(err.Error(), "usage:") {
+			t.Errorf("%v: got error %v; want a usage error", args, err)
+		}
+	}
+	if n := countMovies(t, a); n != 0 {
+		t.Errorf("got %d movies; want none", n)
+	}
+}
+
+func TestSeedGenerate(t *testing.T) {
+	a := newTestAdmin(t)
+
+	out := a.mustRun(t, "", "seed", "-generate", "3", "-rand-seed", "1")
+	if out != "movies: 3 inserted, 0 updated, 0 unchanged\n" {
+		t.Errorf("got output %q", out)
+	}
+	if n := countMovies(t, a); n != 3 {
+		t.Errorf("got %d movies; want 3", n)
+	}
+
+	// The same seed generates the same movies.
+	other := newTestAdmin(t)
+	other.mustRun(t, "", "seed", "-generate", "3", "-rand-seed", "1")
+	for id := int64(1); id <= 3; id++ {
+		want, err := a.models.Movies.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := other.models.Movies.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != want.Title || got.Year != want.Year || got.Runtime != want.Runtime {
+			t.Errorf("movie %d: got %+v; want %+v", id, got, want)
+		}
+	}
+}
+
+func TestSeedFixture(t *testing.T) {
+	a := newTestAdmin(t)
+	file := writeFixture(t, "seed.yaml", `
+movies:
+  - title: Moana
+    year: 2016
+    runtime: 107
+    genres: [animation, adventure]
+  - title: Black Panther
+    year: 2018
+    runtime: 134
+    genres: [action]
+users:
+  - name: Alice
+    email: alice@example.com
+    password: pa55word1234
+    activated: true
+    permissions: [movies:read]
+`)
+
+	out := a.mustRun(t, "", "seed", "-file", file)
+	want := "movies: 2 inserted, 0 updated, 0 unchanged\nusers: 1 inserted, 0 updated, 0 unchanged\n"
+	if out != want {
+		t.Errorf("got output %q; want %q", out, want)
+	}
+	if out := a.mustRun(t, "", "permissions", "alice@example.com"); out != "movies:read\n" {
+		t.Errorf("got permissions %q", out)
+	}
+
+	// Loading the same file again changes nothing.
+	out = a.mustRun(t, "", "seed", "-file", file)
+	want = "movies: 0 inserted, 0 updated, 2 unchanged\nusers: 0 inserted, 0 updated, 1 unchanged\n"
+	if out != want {
+		t.Errorf("got output %q on the second load; want %q", out, want)
+	}
+
+	// A JSON fixture with a changed runtime updates the existing movie.
+	file = writeFixture(t, "seed.json",
+		`{"movies": [{"title": "Moana", "year": 2016, "runtime": 110, "genres": ["animation", "adventure"]}]}`)
+	out = a.mustRun(t, "", "seed", "-file", file)
+	if !strings.HasPrefix(out, "movies: 0 inserted, 1 updated, 0 unchanged\n") {
+		t.Errorf("got output %q; want one movie updated", out)
+	}
+	if n := countMovies(t, a); n != 2 {
+		t.Errorf("got %d movies; want 2", n)
+	}
+}
+
+func TestSeedFixtureErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"unknown field", "seed.yaml", "movies:\n  - title: Moana\n    yaer: 2016\n", "yaer"},
+		{"reviews", "seed.json", `{"reviews": [{"rating": 5}]}`, "no reviews table"},
+		{"extension", "seed.txt", "movies: []", ".json, .yaml or .yml"},
+		{"invalid movie", "seed.json", `{"movies": [{"title": "", "year": 2016, "runtime": 107, "genres": ["drama"]}]}`, "title:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAdmin(t)
+			_, err := a.runTest(t, "", "seed", "-file", writeFixture(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v; want one containing %q", err, tt.wantErr)
+			}
+			if n := countMovies(t, a); n != 0 {
+				t.Errorf("got %d movies; want none", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+)
+
+// newTestAdmin returns an admin backed by the in-memory data backend, which
+// writes its output to a buffer.
+func newTestAdmin(t *testing.T) *admin {
+	t.Helper()
+
+	return &admin{
+		ctx:    context.Background(),
+		models: data.NewMemoryModels(),
+		in:     strings.NewReader(""),
+		out:    &bytes.Buffer{},
+	}
+}
+
+// runTest runs a command with stdin as its standard input and returns what
+// it printed.
+func (a *admin) runTest(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+
+	a.in = strings.NewReader(stdin)
+	out := a.out.(*bytes.Buffer)
+	out.Reset()
+
+	err := a.run(args[0], args[1:])
+	return out.String(), err
+}
+
+// mustRun runs a command which is expected to succeed.
+func (a *admin) mustRun(t *testing.T, stdin string, args ...string) string {
+	t.Helper()
+
+	out, err := a.runTest(t, stdin, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
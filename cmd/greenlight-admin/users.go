@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jahidhimon/greenlight.git/internal/data"
+	"github.com/jahidhimon/greenlight.git/internal/validator"
+)
+
+func (a *admin) listUsers(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: list")
+	}
+
+	users, err := a.models.Users.GetAll(a.ctx)
+	if err != nil {
+		return err
+	}
+	return a.printUsers(users)
+}
+
+func (a *admin) createUser(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	name := fs.String("name", "", "User's name")
+	email := fs.String("email", "", "User's email address")
+	plaintext := fs.String("password", "", "User's password")
+	activated := fs.Bool("activated", false, "Create the user already activated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: create -name N -email E [-password P] [-activated]")
+	}
+
+	if *plaintext == "" {
+		var err error
+		*plaintext, err = readLine(a.in)
+		if err != nil {
+			return err
+		}
+	}
+
+	user := &data.User{
+		Name:      *name,
+		Email:     *email,
+		Activated: *activated,
+	}
+
+	err := user.Password.Set(*plaintext)
+	if err != nil {
+		return err
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		return validationError(v)
+	}
+
+	err = a.models.Users.Insert(a.ctx, user)
+	if err != nil {
+		return err
+	}
+	return a.printUsers([]*data.User{user})
+}
+
+func (a *admin) setActivated(args []string, activated bool) error {
+	if len(args) != 1 {
+		return errors.New("usage: activate|deactivate <user>")
+	}
+
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	user.Activated = activated
+	err = a.models.Users.Update(a.ctx, user)
+	if err != nil {
+		return err
+	}
+	return a.printUsers([]*data.User{user})
+}
+
+func (a *admin) deleteUser(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: delete <user>")
+	}
+
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	err = a.models.Users.Delete(a.ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	return a.printMessage(fmt.Sprintf("user %d deleted", user.ID))
+}
+
+func (a *admin) resetPassword(args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	plaintext := fs.String("password", "", "New password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: reset-password [-password P] <user>")
+	}
+
+	user, err := a.findUser(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *plaintext == "" {
+		*plaintext, err = readLine(a.in)
+		if err != nil {
+			return err
+		}
+	}
+
+	v := validator.New()
+	if data.ValidatePasswordPlainText(v, *plaintext); !v.Valid() {
+		return validationError(v)
+	}
+
+	err = user.Password.Set(*plaintext)
+	if err != nil {
+		return err
+	}
+
+	err = a.models.Users.Update(a.ctx, user)
+	if err != nil {
+		return err
+	}
+	return a.printMessage(fmt.Sprintf("password for user %d reset", user.ID))
+}
+
+func (a *admin) listPermissions(args []string) error {
+	var permissions data.Permissions
+	var err error
+
+	switch len(args) {
+	case 0:
+		permissions, err = a.models.Permissions.GetAll(a.ctx)
+	case 1:
+		var user *data.User
+		user, err = a.findUser(args[0])
+		if err != nil {
+			return err
+		}
+		permissions, err = a.models.Permissions.GetAllForUser(a.ctx, user.ID)
+	default:
+		return errors.New("usage: permissions [<user>]")
+	}
+	if err != nil {
+		return err
+	}
+	return a.printPermissions(permissions)
+}
+
+func (a *admin) changePermissions(args []string, grant bool) error {
+	if len(args) < 2 {
+		return errors.New("usage: grant|revoke <user> <code>...")
+	}
+
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	codes := args[1:]
+	if grant {
+		err = a.models.Permissions.AddForUser(a.ctx, user.ID, codes...)
+	} else {
+		err = a.models.Permissions.RemoveForUser(a.ctx, user.ID, codes...)
+	}
+	if err != nil {
+		return err
+	}
+
+	permissions, err := a.models.Permissions.GetAllForUser(a.ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	return a.printPermissions(permissions)
+}
+
+// findUser looks a user up by ID if ref is a number, or by email otherwise.
+func (a *admin) findUser(ref string) (*data.User, error) {
+	var user *data.User
+	var err error
+
+	if id, convErr := strconv.ParseInt(ref, 10, 64); convErr == nil {
+		user, err = a.models.Users.Get(a.ctx, id)
+	} else {
+		user, err = a.models.Users.GetByEmail(a.ctx, ref)
+	}
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return nil, fmt.Errorf("no user %q", ref)
+	}
+	return user, err
+}
+
+// readLine reads a single line, without the line ending, from r.
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// validationError turns the validator's errors into a single error, with the
+// fields in a stable order.
+func validationError(v *validator.Validator) error {
+	keys := make([]string, 0, len(v.Errors))
+	for key := range v.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	msgs := make([]string, len(keys))
+	for i, key := range keys {
+		msgs[i] = key + ": " + v.Errors[key]
+	}
+	return errors.New("invalid input: " + strings.Join(msgs, "; "))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCreateUser(t *testing.T) {
+	a := newTestAdmin(t)
+
+	out := a.mustRun(t, "", "create", "-name", "Alice", "-email", "alice@example.com",
+		"-password", "pa55word1234", "-activated")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID ") ||
+		!strings.Contains(lines[1], "alice@example.com") || !strings.Contains(lines[1], "true") {
+		t.Errorf("got output %q; want a table with an activated Alice", out)
+	}
+
+	// Without -password the password is read from standard input.
+	a.mustRun(t, "pa55word5678\n", "create", "-name", "Bob", "-email", "bob@example.com")
+	bob, err := a.findUser("bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match, _ := bob.Password.Matches("pa55word5678"); !match || bob.Activated {
+		t.Errorf("got %+v; want an inactive Bob with the password from stdin", bob)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		wantErr string
+	}{
+		{"invalid email", []string{"create", "-name", "Carol", "-email", "carol", "-password", "pa55word1234"}, "", "email:"},
+		{"duplicate email", []string{"create", "-name", "Alice", "-email", "alice@example.com", "-password", "pa55word1234"}, "", "duplicate email"},
+		{"no password", []string{"create", "-name", "Carol", "-email", "carol@example.com"}, "", "reading password"},
+		{"extra argument", []string{"create", "-name", "Carol", "extra"}, "", "usage:"},
+		{"unknown flag", []string{"create", "-admin"}, "", "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.runTest(t, tt.stdin, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v; want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListUsersJSON(t *testing.T) {
+	a := newTestAdmin(t)
+	a.mustRun(t, "", "create", "-name", "Alice", "-email", "alice@example.com", "-password", "pa55word1234")
+	a.mustRun(t, "", "create", "-name", "Bob", "-email", "bob@example.com", "-password", "pa55word1234")
+
+	a.json = true
+	out := a.mustRun(t, "", "list")
+
+	var users []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &users); err != nil {
+		t.Fatalf("%v in %s", err, out)
+	}
+	if len(users) != 2 || users[0]["email"] != "alice@example.com" || users[1]["email"] != "bob@example.com" {
+		t.Errorf("got %v; want Alice and Bob", users)
+	}
+	if strings.Contains(out, "pa55word") || strings.Contains(out, "password") {
+		t.Errorf("output %s includes the password", out)
+	}
+
+	if _, err := a.runTest(t, "", "list", "extra"); err == nil {
+		t.Error("got nil error for list with an argument")
+	}
+}
+
+func TestUserCommands(t *testing.T) {
+	a := newTestAdmin(t)
+	a.mustRun(t, "", "create", "-name", "Alice", "-email", "alice@example.com", "-password", "pa55word1234")
+
+	// Users can be given by email address or by ID.
+	a.mustRun(t, "", "activate", "alice@example.com")
+	alice, err := a.models.Users.Get(context.Background(), 1)
+	if err != nil || !alice.Activated {
+		t.Fatalf("got %+v, %v; want Alice activated", alice, err)
+	}
+	a.mustRun(t, "", "deactivate", "1")
+	alice, err = a.models.Users.Get(context.Background(), 1)
+	if err != nil || alice.Activated {
+		t.Fatalf("got %+v, %v; want Alice deactivated", alice, err)
+	}
+
+	out := a.mustRun(t, "n3wpassword99\n", "reset-password", "alice@example.com")
+	if out != "password for user 1 reset\n" {
+		t.Errorf("got output %q", out)
+	}
+	alice, _ = a.findUser("1")
+	if match, _ := alice.Password.Matches("n3wpassword99"); !match {
+		t.Error("password wasn't reset")
+	}
+	if _, err := a.runTest(t, "", "reset-password", "-password", "short", "1"); err == nil ||
+		!strings.Contains(err.Error(), "password:") {
+		t.Errorf("got error %v; want a password validation error", err)
+	}
+
+	a.json = true
+	out = a.mustRun(t, "", "delete", "alice@example.com")
+	if strings.TrimSpace(out) != "{\n  \"message\": \"user 1 deleted\"\n}" {
+		t.Errorf("got output %q", out)
+	}
+	for _, args := range [][]string{{"activate", "1"}, {"delete", "alice@example.com"}} {
+		if _, err := a.runTest(t, "", args...); err == nil || !strings.Contains(err.Error(), "no user") {
+			t.Errorf("%v: got error %v; want no user", args, err)
+		}
+	}
+}
+
+func TestPermissionCommands(t *testing.T) {
+	a := newTestAdmin(t)
+	a.mustRun(t, "", "create", "-name", "Alice", "-email", "alice@example.com", "-password", "pa55word1234")
+
+	out := a.mustRun(t, "", "permissions")
+	if out != "admin\nmovies:read\nmovies:write\n" {
+		t.Errorf("got output %q; want every permission", out)
+	}
+
+	out = a.mustRun(t, "", "grant", "alice@example.com", "movies:read", "movies:write")
+	if out != "movies:read\nmovies:write\n" {
+		t.Errorf("got output %q after grant", out)
+	}
+	out = a.mustRun(t, "", "revoke", "1", "movies:write")
+	if out != "movies:read\n" {
+		t.Errorf("got output %q after revoke", out)
+	}
+	if _, err := a.runTest(t, "", "grant", "1", "movies:fly"); err == nil {
+		t.Error("got nil error granting an unknown permission")
+	}
+	if _, err := a.runTest(t, "", "grant", "1"); err == nil || !strings.Contains(err.Error(), "usage:") {
+		t.Errorf("got error %v; want a usage error", err)
+	}
+
+	// A user without permissions is an empty JSON list, not null.
+	a.mustRun(t, "", "revoke", "1", "movies:read")
+	a.json = true
+	if out := a.mustRun(t, "", "permissions", "1"); strings.TrimSpace(out) != "[]" {
+		t.Errorf("got output %q; want []", out)
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	a := newTestAdmin(t)
+	if _, err := a.runTest(t, "", "frobnicate"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("got error %v; want unknown command", err)
+	}
+}
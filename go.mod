@@ -1,14 +1,16 @@
 module github.com/jahidhimon/greenlight.git
 
-go 1.17
+go 1.21
 
 require github.com/julienschmidt/httprouter v1.3.0
 
-require github.com/lib/pq v1.10.2
-
 require (
-	github.com/go-mail/mail/v2 v2.3.0 // indirect
-	golang.org/x/crypto v0.0.0-20220331220935-ae2d96664a29 // indirect
-	golang.org/x/time v0.0.0-20220224211638-0e9765cccd65 // indirect
-	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
+	github.com/andybalholm/brotli v1.1.0
+	github.com/go-mail/mail/v2 v2.3.0
+	github.com/lib/pq v1.10.2
+	golang.org/x/crypto v0.0.0-20220331220935-ae2d96664a29
+	golang.org/x/time v0.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
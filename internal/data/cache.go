@@ -0,0 +1,456 @@
+package data
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats counts what a MovieCache has been doing since it was created.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+// MovieCache is a MovieRepository which keeps the results of Get and GetAll in
+// memory, in front of another MovieRepository. It holds at most size results,
+// dropping the least recently used first, and each one for at most ttl.
+//
+// Writing a movie through the cache drops the cached copy of that movie and
+// every cached list. A movie read by Get is only cached if no write happened
+// while it was being read, and a cached movie is never replaced by an older
+// version, so the cache doesn't go back to a copy from before a write.
+// Writes which don't go through the cache, such as those made by another API
+// instance, are seen once the ttl runs out.
+//
+// Concurrent misses for the same result share a single query. It runs apart
+// from the requests waiting on it, bounded by timeouts rather than by any one
+// request's context, so a client going away doesn't fail the others.
+type MovieCache struct {
+	next     MovieRepository
+	ttl      time.Duration
+	timeouts Timeouts
+
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List // front is the most recently used
+	// gen goes up on every write, so that loads which raced with a write
+	// can tell, and so that lists cached before a write are never used.
+	gen uint64
+
+	calls callGroup
+
+	hits, misses, evictions uint64
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+type cachedList struct {
+	movies   []*Movie
+	metadata Metadata
+}
+
+func NewMovieCache(next MovieRepository, size int, ttl time.Duration, timeouts Timeouts) *MovieCache {
+	return &MovieCache{
+		next:     next,
+		ttl:      ttl,
+		timeouts: timeouts,
+		size:     size,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Stats returns the cache's counters.
+func (c *MovieCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := c.lru.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Entries:   entries,
+	}
+}
+
+func movieKey(id int64) string {
+	return fmt.Sprintf("movie:%d", id)
+}
+
+// Get returns the movie from the cache if it's there, and otherwise reads it
+// and caches it. Reads with a context from UsePrimary skip the cache, as
+// they're used for movies which are about to be changed.
+func (c *MovieCache) Get(ctx context.Context, id int64) (*Movie, error) {
+	if ctx.Value(primaryContextKey{}) != nil {
+		return c.next.Get(ctx, id)
+	}
+
+	// The generation is read before the lookup and is part of the key for
+	// the shared query, so a read which starts after a write never waits on
+	// a query which started before it.
+	gen := c.generation()
+	key := movieKey(id)
+	if v, ok := c.lookup(key); ok {
+		return copyMovie(*v.(*Movie)), nil
+	}
+
+	callKey := fmt.Sprintf("%s:%d", key, gen)
+	v, err := c.calls.do(ctx, callKey, c.timeouts.Read, func(ctx context.Context) (interface{}, error) {
+		movie, err := c.next.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		c.store(key, movie, gen)
+		return movie, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyMovie(*v.(*Movie)), nil
+}
+
+// GetAll caches each list under its query and the generation it was read in,
+// so a write makes every list cached before it unreachable. They're dropped
+// when they reach the end of the LRU list or expire.
+func (c *MovieCache) GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	if ctx.Value(primaryContextKey{}) != nil {
+		return c.next.GetAll(ctx, title, genres, filters)
+	}
+
+	gen := c.generation()
+	key := fmt.Sprintf("list:%d:%q:%q:%d:%d:%s", gen, title, genres,
+		filters.Page, filters.PageSize, filters.Sort)
+
+	v, ok := c.lookup(key)
+	if !ok {
+		var err error
+		v, err = c.calls.do(ctx, key, c.timeouts.List, func(ctx context.Context) (interface{}, error) {
+			movies, metadata, err := c.next.GetAll(ctx, title, genres, filters)
+			if err != nil {
+				return nil, err
+			}
+			result := &cachedList{movies: movies, metadata: metadata}
+			c.store(key, result, gen)
+			return result, nil
+		})
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	result := v.(*cachedList)
+	movies := make([]*Movie, len(result.movies))
+	for i, movie := range result.movies {
+		movies[i] = copyMovie(*movie)
+	}
+	return movies, result.metadata, nil
+}
+
+func (c *MovieCache) GetByTitleAndYear(ctx context.Context, title string, year int32) (*Movie, error) {
+	return c.next.GetByTitleAndYear(ctx, title, year)
+}
+
+func (c *MovieCache) Insert(ctx context.Context, movie *Movie) error {
+	err := c.next.Insert(ctx, movie)
+	c.invalidate(movie.ID, nil)
+	return err
+}
+
+// Update caches the movie as it is after the update, so that the next read of
+// a popular movie doesn't have to go to the database.
+func (c *MovieCache) Update(ctx context.Context, movie *Movie) error {
+	err := c.next.Update(ctx, movie)
+	if err != nil {
+		c.invalidate(movie.ID, nil)
+		return err
+	}
+	c.invalidate(movie.ID, copyMovie(*movie))
+	return nil
+}
+
+func (c *MovieCache) Delete(ctx context.Context, id int64) error {
+	err := c.next.Delete(ctx, id)
+	c.invalidate(id, nil)
+	return err
+}
+
+// Purge empties the cache.
+func (c *MovieCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *MovieCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// lookup returns the unexpired value cached under key, and counts the hit or
+// miss.
+func (c *MovieCache) lookup(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if ok && time.Now().Before(el.Value.(*cacheEntry).expires) {
+		c.lru.MoveToFront(el)
+		atomic.AddUint64(&c.hits, 1)
+		return el.Value.(*cacheEntry).value, true
+	}
+	if ok {
+		c.remove(el)
+	}
+	atomic.AddUint64(&c.misses, 1)
+	return nil, false
+}
+
+// store caches value under key, unless there has been a write since
+// generation gen, when value may already be out of date.
+func (c *MovieCache) store(key string, value interface{}, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen != gen {
+		return
+	}
+	c.set(key, value)
+}
+
+// invalidate records a write to the movie with the given ID: lists cached
+// before it and the cached copy of the movie are no longer used. If movie is
+// given it's cached in place of the old copy, unless the cache somehow has a
+// later version already. The caller must not hold the lock.
+func (c *MovieCache) invalidate(id int64, movie *Movie) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+
+	key := movieKey(id)
+	el, ok := c.entries[key]
+	if movie == nil {
+		if ok {
+			c.remove(el)
+		}
+		return
+	}
+	if ok && el.Value.(*cacheEntry).value.(*Movie).Version > movie.Version {
+		return
+	}
+	c.set(key, movie)
+}
+
+// set caches value under key, evicting the least recently used entry if the
+// cache is full. The caller must hold the lock.
+func (c *MovieCache) set(key string, value interface{}) {
+	expires := time.Now().Add(c.ttl)
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.value = value
+		entry.expires = expires
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	if c.size <= 0 {
+		return
+	}
+	for c.lru.Len() >= c.size {
+		c.remove(c.lru.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value, expires: expires})
+}
+
+// remove drops an entry. The caller must hold the lock.
+func (c *MovieCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// callGroup makes concurrent calls with the same key share one call of the
+// function.
+type callGroup struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+var errCallPanicked = errors.New("data: shared query panicked")
+
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// do returns the result of fn, starting it if no call with the same key is
+// running. fn runs in its own goroutine with a context which keeps the values
+// of the first caller's ctx but not its cancellation, and which expires after
+// timeout. Each caller stops waiting when its own ctx is done.
+func (g *callGroup) do(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.run(context.WithoutCancel(ctx), key, c, timeout, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *callGroup) run(ctx context.Context, key string, c *call, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	defer func() {
+		// fn isn't running on a request's goroutine, so a panic would
+		// otherwise take down the whole process.
+		if p := recover(); p != nil {
+			c.value, c.err = nil, fmt.Errorf("%w: %v", errCallPanicked, p)
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.value, c.err = fn(ctx)
+}
+
+// cachedTx runs transactions with next. The movies written in a transaction
+// don't go through the cache, so it notes which ones they are and, once the
+// transaction is committed, drops them and the cached lists. Transactions
+// which don't write movies leave the cache alone.
+type cachedTx struct {
+	next  txRunner
+	cache *MovieCache
+}
+
+func (t cachedTx) transaction(ctx context.Context, fn func(tx Models) error) error {
+	var writes *movieWrites
+	err := t.next.transaction(ctx, func(tx Models) error {
+		// fn runs again if the transaction is retried, and only the
+		// writes from the attempt which is committed count.
+		writes = &movieWrites{ids: make(map[int64]bool)}
+		return fn(writes.models(tx))
+	})
+	if err == nil && writes != nil {
+		for _, id := range writes.written() {
+			t.cache.invalidate(id, nil)
+		}
+	}
+	return err
+}
+
+// movieWrites records the IDs of the movies written through the models it
+// wraps, including in nested transactions.
+type movieWrites struct {
+	mu  sync.Mutex
+	ids map[int64]bool
+}
+
+func (w *movieWrites) models(tx Models) Models {
+	tx.Movies = recordingMovies{MovieRepository: tx.Movies, writes: w}
+	if tx.tx != nil {
+		tx.tx = recordingTx{next: tx.tx, writes: w}
+	}
+	return tx
+}
+
+func (w *movieWrites) add(id int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ids[id] = true
+}
+
+func (w *movieWrites) written() []int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ids := make([]int64, 0, len(w.ids))
+	for id := range w.ids {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// recordingTx wraps the models of nested transactions, so that their writes
+// are recorded too. A nested transaction which is rolled back still counts,
+// which only costs a few extra cache misses.
+type recordingTx struct {
+	next   txRunner
+	writes *movieWrites
+}
+
+func (t recordingTx) transaction(ctx context.Context, fn func(tx Models) error) error {
+	return t.next.transaction(ctx, func(tx Models) error {
+		return fn(t.writes.models(tx))
+	})
+}
+
+type recordingMovies struct {
+	MovieRepository
+	writes *movieWrites
+}
+
+func (m recordingMovies) Insert(ctx context.Context, movie *Movie) error {
+	err := m.MovieRepository.Insert(ctx, movie)
+	if err == nil {
+		m.writes.add(movie.ID)
+	}
+	return err
+}
+
+func (m recordingMovies) Update(ctx context.Context, movie *Movie) error {
+	err := m.MovieRepository.Update(ctx, movie)
+	m.writes.add(movie.ID)
+	return err
+}
+
+func (m recordingMovies) Delete(ctx context.Context, id int64) error {
+	err := m.MovieRepository.Delete(ctx, id)
+	m.writes.add(id)
+	return err
+}
+
+// WithMovieCache returns a copy of m whose Movies are cached by a new
+// MovieCache, which is also returned for its Stats. Queries shared between
+// requests are bounded by timeouts.
+func (m Models) WithMovieCache(size int, ttl time.Duration, timeouts Timeouts) (Models, *MovieCache) {
+	cache := NewMovieCache(m.Movies, size, ttl, timeouts)
+	m.Movies = cache
+	if m.tx != nil {
+		m.tx = cachedTx{next: m.tx, cache: cache}
+	}
+	return m, cache
+}
@@ -0,0 +1,332 @@
+package data
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingMovies counts the calls to Get and GetAll which reach the
+// repository behind a cache.
+type countingMovies struct {
+	MovieRepository
+
+	mu          sync.Mutex
+	gets, lists int
+	release     chan struct{} // if set, Get waits for it to be closed or ctx to end
+}
+
+func (m *countingMovies) Get(ctx context.Context, id int64) (*Movie, error) {
+	m.mu.Lock()
+	m.gets++
+	m.mu.Unlock()
+
+	if m.release != nil {
+		select {
+		case <-m.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return m.MovieRepository.Get(ctx, id)
+}
+
+func (m *countingMovies) GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	m.mu.Lock()
+	m.lists++
+	m.mu.Unlock()
+
+	return m.MovieRepository.GetAll(ctx, title, genres, filters)
+}
+
+func newTestCache(t *testing.T, size int, ttl time.Duration) (*MovieCache, *countingMovies) {
+	t.Helper()
+
+	counting := &countingMovies{MovieRepository: NewMemoryModels().Movies}
+	return NewMovieCache(counting, size, ttl, DefaultTimeouts()), counting
+}
+
+func TestMovieCacheGet(t *testing.T) {
+	ctx := context.Background()
+	cache, counting := newTestCache(t, 10, time.Minute)
+
+	movie := newTestMovie("Moana")
+	if err := cache.Insert(ctx, movie); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		got, err := cache.Get(ctx, movie.ID)
+		if err != nil || got.Title != "Moana" {
+			t.Fatalf("got %v, %v; want Moana", got, err)
+		}
+		// Changing the copy returned mustn't change the cached movie.
+		got.Title = "changed"
+	}
+
+	if counting.gets != 1 {
+		t.Errorf("got %d reads from the repository; want 1", counting.gets)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("got %+v; want 2 hits and 1 miss", stats)
+	}
+
+	// Reads for an update go past the cache.
+	if _, err := cache.Get(UsePrimary(ctx), movie.ID); err != nil {
+		t.Fatal(err)
+	}
+	if counting.gets != 2 {
+		t.Errorf("got %d reads from the repository; want 2", counting.gets)
+	}
+}
+
+func TestMovieCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	cache, counting := newTestCache(t, 10, time.Minute)
+	filters := Filters{Page: 1, PageSize: 20, Sort: "id", SortSafeList: []string{"id"}}
+
+	movie := newTestMovie("Moana")
+	cache.Insert(ctx, movie)
+	cache.Get(ctx, movie.ID)
+	cache.GetAll(ctx, "", nil, filters)
+
+	movie.Title = "Moana 2"
+	if err := cache.Update(ctx, movie); err != nil {
+		t.Fatal(err)
+	}
+
+	// The updated movie is cached, so reading it doesn't reach the
+	// repository, but the list has to be read again.
+	got, err := cache.Get(ctx, movie.ID)
+	if err != nil || got.Title != "Moana 2" || got.Version != 2 {
+		t.Errorf("got %+v, %v; want version 2 of Moana 2", got, err)
+	}
+	movies, _, err := cache.GetAll(ctx, "", nil, filters)
+	if err != nil || len(movies) != 1 || movies[0].Title != "Moana 2" {
+		t.Errorf("got %v, %v; want [Moana 2]", movies, err)
+	}
+	if counting.gets != 1 || counting.lists != 2 {
+		t.Errorf("got %d gets and %d lists; want 1 and 2", counting.gets, counting.lists)
+	}
+
+	if err := cache.Delete(ctx, movie.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get(ctx, movie.ID); err != ErrRecordNotFound {
+		t.Errorf("got error %v; want %v", err, ErrRecordNotFound)
+	}
+}
+
+func TestMovieCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	cache, counting := newTestCache(t, 2, time.Minute)
+
+	var ids []int64
+	for _, title := range []string{"Moana", "Frozen", "Coco"} {
+		movie := newTestMovie(title)
+		cache.Insert(ctx, movie)
+		ids = append(ids, movie.ID)
+	}
+
+	cache.Get(ctx, ids[0])
+	cache.Get(ctx, ids[1])
+	cache.Get(ctx, ids[0]) // ids[1] is now the least recently used
+	cache.Get(ctx, ids[2]) // so it's evicted
+	cache.Get(ctx, ids[0])
+	cache.Get(ctx, ids[1])
+
+	if counting.gets != 4 {
+		t.Errorf("got %d reads from the repository; want 4", counting.gets)
+	}
+	if stats := cache.Stats(); stats.Evictions != 2 || stats.Entries != 2 {
+		t.Errorf("got %+v; want 2 evictions and 2 entries", stats)
+	}
+}
+
+func TestMovieCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, counting := newTestCache(t, 10, time.Millisecond)
+
+	movie := newTestMovie("Moana")
+	cache.Insert(ctx, movie)
+	cache.Get(ctx, movie.ID)
+	time.Sleep(5 * time.Millisecond)
+	cache.Get(ctx, movie.ID)
+
+	if counting.gets != 2 {
+		t.Errorf("got %d reads from the repository; want 2", counting.gets)
+	}
+}
+
+func TestMovieCacheSharesMisses(t *testing.T) {
+	ctx := context.Background()
+	cache, counting := newTestCache(t, 10, time.Minute)
+
+	movie := newTestMovie("Moana")
+	cache.Insert(ctx, movie)
+	counting.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Get(ctx, movie.ID); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// Give the goroutines time to queue up behind the first read.
+	time.Sleep(20 * time.Millisecond)
+	close(counting.release)
+	wg.Wait()
+
+	if counting.gets != 1 {
+		t.Errorf("got %d reads from the repository; want 1", counting.gets)
+	}
+}
+
+func TestMovieCacheSharedMissOutlivesCaller(t *testing.T) {
+	cache, counting := newTestCache(t, 10, time.Minute)
+
+	movie := newTestMovie("Moana")
+	cache.Insert(context.Background(), movie)
+	counting.release = make(chan struct{})
+
+	// The first caller starts the shared read and then goes away.
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error)
+	go func() {
+		_, err := cache.Get(ctx, movie.ID)
+		leader <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	waiter := make(chan error)
+	go func() {
+		_, err := cache.Get(context.Background(), movie.ID)
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-leader; err != context.Canceled {
+		t.Errorf("got error %v for the cancelled caller; want %v", err, context.Canceled)
+	}
+
+	close(counting.release)
+	if err := <-waiter; err != nil {
+		t.Errorf("got error %v for the waiting caller; want nil", err)
+	}
+	if counting.gets != 1 {
+		t.Errorf("got %d reads from the repository; want 1", counting.gets)
+	}
+}
+
+func TestMovieCacheMissAfterWrite(t *testing.T) {
+	ctx := context.Background()
+	cache, counting := newTestCache(t, 10, time.Minute)
+
+	movie := newTestMovie("Moana")
+	cache.Insert(ctx, movie)
+	counting.release = make(chan struct{})
+
+	// A read which starts before the delete...
+	before := make(chan error)
+	go func() {
+		_, err := cache.Get(ctx, movie.ID)
+		before <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := cache.Delete(ctx, movie.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// ...mustn't be shared with one which starts after it.
+	after := make(chan error)
+	go func() {
+		_, err := cache.Get(ctx, movie.ID)
+		after <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	close(counting.release)
+	<-before
+	if err := <-after; err != ErrRecordNotFound {
+		t.Errorf("got error %v; want %v", err, ErrRecordNotFound)
+	}
+	if counting.gets != 2 {
+		t.Errorf("got %d reads from the repository; want 2", counting.gets)
+	}
+}
+
+func TestMovieCacheTransaction(t *testing.T) {
+	ctx := context.Background()
+	models, cache := NewMemoryModels().WithMovieCache(10, time.Minute, DefaultTimeouts())
+
+	movie := newTestMovie("Moana")
+	models.Movies.Insert(ctx, movie)
+	models.Movies.Get(ctx, movie.ID)
+
+	err := models.Transaction(ctx, func(tx Models) error {
+		movie.Title = "Moana 2"
+		return tx.Movies.Update(ctx, movie)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := models.Movies.Get(ctx, movie.ID)
+	if err != nil || got.Title != "Moana 2" {
+		t.Errorf("got %+v, %v; want Moana 2", got, err)
+	}
+	if stats := cache.Stats(); stats.Hits != 0 {
+		t.Errorf("got %+v; want no hits", stats)
+	}
+}
+
+func TestMovieCacheTransactionKeepsUnwrittenMovies(t *testing.T) {
+	ctx := context.Background()
+	models, cache := NewMemoryModels().WithMovieCache(10, time.Minute, DefaultTimeouts())
+
+	moana, coco := newTestMovie("Moana"), newTestMovie("Coco")
+	models.Movies.Insert(ctx, moana)
+	models.Movies.Insert(ctx, coco)
+	models.Movies.Get(ctx, moana.ID)
+	models.Movies.Get(ctx, coco.ID)
+
+	// A transaction which doesn't write movies leaves them all cached.
+	err := models.Transaction(ctx, func(tx Models) error {
+		return tx.Users.Insert(ctx, &User{Name: "Alice", Email: "alice@example.com"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	models.Movies.Get(ctx, moana.ID)
+	models.Movies.Get(ctx, coco.ID)
+	if stats := cache.Stats(); stats.Hits != 2 {
+		t.Errorf("got %+v; want 2 hits", stats)
+	}
+
+	// A movie written in a nested transaction is dropped, the other isn't.
+	err = models.Transaction(ctx, func(tx Models) error {
+		return tx.Transaction(ctx, func(tx Models) error {
+			moana.Title = "Moana 2"
+			return tx.Movies.Update(ctx, moana)
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := models.Movies.Get(ctx, moana.ID)
+	if err != nil || got.Title != "Moana 2" {
+		t.Errorf("got %+v, %v; want Moana 2", got, err)
+	}
+	models.Movies.Get(ctx, coco.ID)
+	if stats := cache.Stats(); stats.Hits != 3 {
+		t.Errorf("got %+v; want 3 hits", stats)
+	}
+}
@@ -0,0 +1,250 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Job states. A job waits in JobPending until its RunAt time, is JobRunning
+// while a worker has it, and is deleted once it succeeds. A job which has
+// failed MaxAttempts times is left in JobDead until someone retries it.
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDead    = "dead"
+)
+
+// Job is a unit of background work, like sending an email, which is kept in
+// the database until it has been done, so that it survives a restart.
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	State       string          `json:"state"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	// Traceparent is the W3C trace context of the request which queued the
+	// job, if it was traced, so that running the job carries on its trace.
+	Traceparent string `json:"traceparent,omitempty"`
+}
+
+// NewJob returns a pending job of the given kind, with payload encoded as its
+// JSON payload, which is ready to run straight away.
+func NewJob(kind string, payload interface{}, maxAttempts int) (*Job, error) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		Kind:        kind,
+		Payload:     js,
+		State:       JobPending,
+		MaxAttempts: maxAttempts,
+		RunAt:       time.Now(),
+	}, nil
+}
+
+// JobModel keeps jobs in the jobs table.
+type JobModel struct {
+	DB       DBTX
+	Timeouts Timeouts
+}
+
+const jobColumns = `id, kind, payload, state, attempts, max_attempts, run_at, last_error, created_at, traceparent`
+
+// scanJob scans a row of jobColumns into job. Queries which select more
+// columns in front of jobColumns pass their destinations as extra.
+func scanJob(row interface{ Scan(...interface{}) error }, job *Job, extra ...interface{}) error {
+	return row.Scan(append(extra,
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.State,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.Traceparent,
+	)...)
+}
+
+func (m JobModel) Enqueue(ctx context.Context, job *Job) error {
+	query := `
+INSERT INTO jobs (kind, payload, max_attempts, run_at, traceparent)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, state, created_at`
+
+	args := []interface{}{job.Kind, []byte(job.Payload), job.MaxAttempts, job.RunAt, job.Traceparent}
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.State, &job.CreatedAt)
+}
+
+// Claim takes the next job which is due, marks it as running and counts the
+// attempt. The job is the worker's until lease runs out; after that it is
+// assumed the worker died and the job can be claimed again. It returns
+// ErrRecordNotFound if there's nothing to do.
+func (m JobModel) Claim(ctx context.Context, lease time.Duration) (*Job, error) {
+	// SKIP LOCKED lets several workers, in this process or others, claim
+	// jobs at the same time without waiting on each other.
+	query := `
+UPDATE jobs
+SET state = 'running', attempts = attempts + 1,
+	locked_until = NOW() + $1 * INTERVAL '1 second'
+WHERE id = (
+	SELECT id FROM jobs
+	WHERE (state = 'pending' AND run_at <= NOW())
+	OR (state = 'running' AND locked_until < NOW())
+	ORDER BY run_at, id
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING ` + jobColumns
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	var job Job
+	err := scanJob(m.DB.QueryRowContext(ctx, query, lease.Seconds()), &job)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+// Complete removes a job which has been done.
+func (m JobModel) Complete(ctx context.Context, id int64) error {
+	query := `DELETE FROM jobs WHERE id = $1`
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// Fail records that an attempt at the job failed with jobErr. If the job has
+// attempts left it goes back to pending until retryAt, otherwise it's dead.
+// job is updated to match.
+func (m JobModel) Fail(ctx context.Context, job *Job, jobErr error, retryAt time.Time) error {
+	query := `
+UPDATE jobs
+SET state = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+	run_at = $2, last_error = $3, locked_until = NULL
+WHERE id = $1
+RETURNING state, run_at, last_error`
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, job.ID, retryAt, jobErr.Error()).Scan(
+		&job.State, &job.RunAt, &job.LastError)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// Retry puts a dead job back in the queue to run straight away, with a fresh
+// set of attempts. It returns ErrRecordNotFound if there is no such dead job.
+func (m JobModel) Retry(ctx context.Context, id int64) (*Job, error) {
+	query := `
+UPDATE jobs
+SET state = 'pending', attempts = 0, run_at = NOW()
+WHERE id = $1 AND state = 'dead'
+RETURNING ` + jobColumns
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	var job Job
+	err := scanJob(m.DB.QueryRowContext(ctx, query, id), &job)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+func (m JobModel) Get(ctx context.Context, id int64) (*Job, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var job Job
+	err := scanJob(m.DB.QueryRowContext(ctx, query, id), &job)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+// GetAll returns the jobs in the given state, or in any state if state is
+// empty, oldest first.
+func (m JobModel) GetAll(ctx context.Context, state string, filters Filters) ([]*Job, Metadata, error) {
+	query := `
+SELECT count(*) OVER(), ` + jobColumns + `
+FROM jobs
+WHERE (state = $1 OR $1 = '')
+ORDER BY id
+LIMIT $2 OFFSET $3`
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, state, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	jobs := []*Job{}
+
+	for rows.Next() {
+		var job Job
+
+		err := scanJob(rows, &job, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return jobs, metadata, nil
+}
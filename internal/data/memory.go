@@ -0,0 +1,695 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// defaultPermissions are the permission codes created by the migrations, so
+// the in-memory backend starts out with the same set as a new database.
+var defaultPermissions = Permissions{"admin", "movies:read", "movies:write"}
+
+// memoryStore holds every record for the in-memory backend. A single mutex
+// guards the lot, which keeps things simple and is plenty fast for demos and
+// tests.
+type memoryStore struct {
+	mu sync.Mutex
+
+	// txMu is held for the whole of a transaction, so that transactions
+	// run one at a time.
+	txMu sync.Mutex
+
+	movies      map[int64]Movie
+	lastMovieID int64
+
+	users      map[int64]User
+	lastUserID int64
+
+	permissions     Permissions
+	userPermissions map[int64]map[string]bool
+
+	// tokens is keyed by the token's hash.
+	tokens map[string]Token
+
+	jobs      map[int64]Job
+	lastJobID int64
+}
+
+// NewMemoryModels returns Models backed by maps in memory instead of
+// PostgreSQL. It behaves like the PostgreSQL models, including filtering,
+// sorting, pagination, version checks and duplicate email errors, but nothing
+// is kept when the process exits. Operations never wait on anything but the
+// store's mutex, so the contexts they are given are ignored.
+func NewMemoryModels() Models {
+	store := &memoryStore{
+		movies:          make(map[int64]Movie),
+		users:           make(map[int64]User),
+		permissions:     append(Permissions{}, defaultPermissions...),
+		userPermissions: make(map[int64]map[string]bool),
+		tokens:          make(map[string]Token),
+		jobs:            make(map[int64]Job),
+	}
+
+	return store.models(memoryTx{store: store})
+}
+
+func (s *memoryStore) models(tx txRunner) Models {
+	return Models{
+		Movies:      memoryMovies{s},
+		Users:       memoryUsers{s},
+		Permissions: memoryPermissions{s},
+		Tokens:      memoryTokens{s},
+		Jobs:        memoryJobs{s},
+		tx:          tx,
+	}
+}
+
+// memoryTx runs transactions on the in-memory backend. A transaction takes a
+// snapshot of the store and puts it back if it fails. Transactions are run one
+// at a time, but writes made outside a transaction aren't isolated from one
+// that is running, and are lost if it rolls back.
+type memoryTx struct {
+	store  *memoryStore
+	nested bool
+}
+
+func (t memoryTx) transaction(ctx context.Context, fn func(tx Models) error) (err error) {
+	if !t.nested {
+		t.store.txMu.Lock()
+		defer t.store.txMu.Unlock()
+	}
+
+	snapshot := t.store.snapshot()
+	defer func() {
+		if v := recover(); v != nil {
+			t.store.restore(snapshot)
+			panic(v)
+		}
+		if err != nil {
+			t.store.restore(snapshot)
+		}
+	}()
+
+	return fn(t.store.models(memoryTx{store: t.store, nested: true}))
+}
+
+// snapshot returns a deep copy of the records in s.
+func (s *memoryStore) snapshot() *memoryStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := &memoryStore{
+		movies:          make(map[int64]Movie, len(s.movies)),
+		users:           make(map[int64]User, len(s.users)),
+		permissions:     append(Permissions{}, s.permissions...),
+		userPermissions: make(map[int64]map[string]bool, len(s.userPermissions)),
+		tokens:          make(map[string]Token, len(s.tokens)),
+		jobs:            make(map[int64]Job, len(s.jobs)),
+	}
+	for id, movie := range s.movies {
+		snapshot.movies[id] = *copyMovie(movie)
+	}
+	for id, user := range s.users {
+		snapshot.users[id] = user
+	}
+	for id, codes := range s.userPermissions {
+		snapshot.userPermissions[id] = make(map[string]bool, len(codes))
+		for code := range codes {
+			snapshot.userPermissions[id][code] = true
+		}
+	}
+	for hash, token := range s.tokens {
+		snapshot.tokens[hash] = token
+	}
+	for id, job := range s.jobs {
+		snapshot.jobs[id] = job
+	}
+	return snapshot
+}
+
+// restore replaces the records in s with those from a snapshot. The last IDs
+// are kept, as PostgreSQL sequences aren't rolled back either.
+func (s *memoryStore) restore(snapshot *memoryStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.movies = snapshot.movies
+	s.users = snapshot.users
+	s.permissions = snapshot.permissions
+	s.userPermissions = snapshot.userPermissions
+	s.tokens = snapshot.tokens
+	s.jobs = snapshot.jobs
+}
+
+// now returns the current time at the one second precision of the
+// timestamp(0) columns used by PostgreSQL.
+func now() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+// copyMovie returns a copy of movie which doesn't share its genres slice, so
+// that callers can't change stored records behind our back.
+func copyMovie(movie Movie) *Movie {
+	if movie.Genres != nil {
+		movie.Genres = append([]string{}, movie.Genres...)
+	}
+	return &movie
+}
+
+type memoryMovies struct {
+	*memoryStore
+}
+
+func (m memoryMovies) Insert(ctx context.Context, movie *Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastMovieID++
+	movie.ID = m.lastMovieID
+	movie.CreatedAt = now()
+	movie.Version = 1
+
+	m.movies[movie.ID] = *copyMovie(*movie)
+	return nil
+}
+
+func (m memoryMovies) Get(ctx context.Context, id int64) (*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return copyMovie(movie), nil
+}
+
+// GetAll mirrors the PostgreSQL query: the title is matched word by word like
+// plainto_tsquery with the 'simple' configuration, the movie must have every
+// one of the genres, and ties in the sort column are broken by ID.
+func (m memoryMovies) GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	column := filters.sortColumn()
+	descending := filters.sortDirection() == "DESC"
+	titleWords := searchWords(title)
+
+	m.mu.Lock()
+	var matches []Movie
+	for _, movie := range m.movies {
+		if containsAll(searchWords(movie.Title), titleWords) && containsAll(movie.Genres, genres) {
+			matches = append(matches, movie)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+
+		var cmp int
+		switch column {
+		case "title":
+			cmp = strings.Compare(a.Title, b.Title)
+		case "year":
+			cmp = compareInt64(int64(a.Year), int64(b.Year))
+		case "runtime":
+			cmp = compareInt64(int64(a.Runtime), int64(b.Runtime))
+		}
+		if column != "id" && cmp != 0 {
+			if descending {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+
+		// Sorting by id honours the direction; as a tie breaker it is
+		// always ascending, like "ORDER BY ..., id ASC".
+		if column == "id" && descending {
+			return a.ID > b.ID
+		}
+		return a.ID < b.ID
+	})
+
+	totalRecords := len(matches)
+	movies := []*Movie{}
+
+	for i := filters.offset(); i < totalRecords && len(movies) < filters.limit(); i++ {
+		movies = append(movies, copyMovie(matches[i]))
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+func (m memoryMovies) GetByTitleAndYear(ctx context.Context, title string, year int32) (*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found *Movie
+	for _, movie := range m.movies {
+		if movie.Title == title && movie.Year == year && (found == nil || movie.ID < found.ID) {
+			found = copyMovie(movie)
+		}
+	}
+	if found == nil {
+		return nil, ErrRecordNotFound
+	}
+	return found, nil
+}
+
+func (m memoryMovies) Update(ctx context.Context, movie *Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[movie.ID]
+	if !ok || stored.Version != movie.Version {
+		return ErrEditConflict
+	}
+
+	movie.Version++
+	stored.Title = movie.Title
+	stored.Year = movie.Year
+	stored.Runtime = movie.Runtime
+	stored.Genres = movie.Genres
+	stored.Version = movie.Version
+
+	m.movies[movie.ID] = *copyMovie(stored)
+	return nil
+}
+
+func (m memoryMovies) Delete(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.movies[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.movies, id)
+	return nil
+}
+
+type memoryUsers struct {
+	*memoryStore
+}
+
+// emailTaken reports whether another user already has the email address.
+// Addresses are compared case-insensitively, like the CITEXT column.
+// The caller must hold the lock.
+func (m memoryUsers) emailTaken(email string, exceptID int64) bool {
+	for id, user := range m.users {
+		if id != exceptID && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m memoryUsers) Insert(ctx context.Context, user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(user.Email, 0) {
+		return ErrDuplicateEmail
+	}
+
+	m.lastUserID++
+	user.ID = m.lastUserID
+	user.CreatedAt = now()
+	user.Version = 1
+
+	// Only the hash is kept, as in the users table.
+	stored := *user
+	stored.Password = password{hash: user.Password.hash}
+	m.users[user.ID] = stored
+	return nil
+}
+
+func (m memoryUsers) Get(ctx context.Context, id int64) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+func (m memoryUsers) GetByEmail(ctx context.Context, email string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m memoryUsers) GetAll(ctx context.Context) ([]*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := []*User{}
+	for _, user := range m.users {
+		user := user
+		users = append(users, &user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (m memoryUsers) GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[string(hash[:])]
+	if !ok || token.Scope != scope || !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+	user, ok := m.users[token.UserID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+func (m memoryUsers) Update(ctx context.Context, user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(user.Email, user.ID) {
+		return ErrDuplicateEmail
+	}
+
+	stored, ok := m.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	user.Version++
+	stored.Name = user.Name
+	stored.Email = user.Email
+	stored.Password = password{hash: user.Password.hash}
+	stored.Activated = user.Activated
+	stored.Locale = user.Locale
+	stored.Version = user.Version
+
+	m.users[user.ID] = stored
+	return nil
+}
+
+func (m memoryUsers) Delete(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.users, id)
+	// Mirror ON DELETE CASCADE on users_permissions and tokens.
+	delete(m.userPermissions, id)
+	for hash, token := range m.tokens {
+		if token.UserID == id {
+			delete(m.tokens, hash)
+		}
+	}
+	return nil
+}
+
+type memoryPermissions struct {
+	*memoryStore
+}
+
+func (m memoryPermissions) GetAll(ctx context.Context) (Permissions, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append(Permissions{}, m.permissions...), nil
+}
+
+func (m memoryPermissions) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var permissions Permissions
+	for code := range m.userPermissions[userID] {
+		permissions = append(permissions, code)
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
+
+func (m memoryPermissions) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, code := range codes {
+		if !m.permissions.Include(code) {
+			return ErrUnknownPermission
+		}
+	}
+
+	// The foreign key on users_permissions.user_id means PostgreSQL
+	// refuses to grant permissions to a user who doesn't exist.
+	if _, ok := m.users[userID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	if m.userPermissions[userID] == nil {
+		m.userPermissions[userID] = make(map[string]bool)
+	}
+	for _, code := range codes {
+		m.userPermissions[userID][code] = true
+	}
+	return nil
+}
+
+func (m memoryPermissions) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, code := range codes {
+		if !m.permissions.Include(code) {
+			return ErrUnknownPermission
+		}
+	}
+
+	for _, code := range codes {
+		delete(m.userPermissions[userID], code)
+	}
+	return nil
+}
+
+type memoryTokens struct {
+	*memoryStore
+}
+
+func (m memoryTokens) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m memoryTokens) Insert(ctx context.Context, token *Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The foreign key on tokens.user_id.
+	if _, ok := m.users[token.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	stored := *token
+	stored.Plaintext = ""
+	m.tokens[string(token.Hash)] = stored
+	return nil
+}
+
+func (m memoryTokens) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, token := range m.tokens {
+		if token.Scope == scope && token.UserID == userID {
+			delete(m.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// memoryJobs keeps a running job's lease in its RunAt time, as there's no
+// locked_until field in Job.
+type memoryJobs struct {
+	*memoryStore
+}
+
+func (m memoryJobs) Enqueue(ctx context.Context, job *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastJobID++
+	job.ID = m.lastJobID
+	job.State = JobPending
+	job.CreatedAt = now()
+
+	m.jobs[job.ID] = *job
+	return nil
+}
+
+func (m memoryJobs) Claim(ctx context.Context, lease time.Duration) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := time.Now()
+
+	var next *Job
+	for _, job := range m.jobs {
+		job := job
+		if job.State == JobDead || job.RunAt.After(t) {
+			continue
+		}
+		if next == nil || job.RunAt.Before(next.RunAt) ||
+			(job.RunAt.Equal(next.RunAt) && job.ID < next.ID) {
+			next = &job
+		}
+	}
+	if next == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	next.State = JobRunning
+	next.Attempts++
+	claimed := *next
+
+	next.RunAt = t.Add(lease)
+	m.jobs[next.ID] = *next
+
+	return &claimed, nil
+}
+
+func (m memoryJobs) Complete(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.jobs, id)
+	return nil
+}
+
+func (m memoryJobs) Fail(ctx context.Context, job *Job, jobErr error, retryAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.jobs[job.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	stored.State = JobPending
+	if stored.Attempts >= stored.MaxAttempts {
+		stored.State = JobDead
+	}
+	stored.RunAt = retryAt
+	stored.LastError = jobErr.Error()
+	m.jobs[job.ID] = stored
+
+	job.State, job.RunAt, job.LastError = stored.State, stored.RunAt, stored.LastError
+	return nil
+}
+
+func (m memoryJobs) Retry(ctx context.Context, id int64) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok || job.State != JobDead {
+		return nil, ErrRecordNotFound
+	}
+
+	job.State = JobPending
+	job.Attempts = 0
+	job.RunAt = now()
+	m.jobs[id] = job
+	return &job, nil
+}
+
+func (m memoryJobs) Get(ctx context.Context, id int64) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &job, nil
+}
+
+func (m memoryJobs) GetAll(ctx context.Context, state string, filters Filters) ([]*Job, Metadata, error) {
+	m.mu.Lock()
+	var matches []*Job
+	for _, job := range m.jobs {
+		job := job
+		if state == "" || job.State == state {
+			matches = append(matches, &job)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	jobs := []*Job{}
+	for i := filters.offset(); i < len(matches) && len(jobs) < filters.limit(); i++ {
+		jobs = append(jobs, matches[i])
+	}
+
+	metadata := calculateMetadata(len(matches), filters.Page, filters.PageSize)
+
+	return jobs, metadata, nil
+}
+
+// searchWords splits s into lower case words the way PostgreSQL's 'simple'
+// text search configuration does.
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// containsAll reports whether every value in want is in have.
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,44 @@
+package data
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryUsersDropPlaintextPassword(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryModels().Users
+
+	user := &User{Name: "Alice", Email: "alice@example.com"}
+	if err := user.Password.Set("pa55word1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(when string) {
+		t.Helper()
+
+		stored, err := users.GetByEmail(ctx, "alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Password.plaintext != nil {
+			t.Errorf("%s: the plaintext password was stored", when)
+		}
+		if match, err := stored.Password.Matches("pa55word1234"); err != nil || !match {
+			t.Errorf("%s: got Matches() = %v, %v; want true, nil", when, match, err)
+		}
+	}
+
+	check("after Insert")
+
+	if err := user.Password.Set("pa55word1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Update(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	check("after Update")
+}
@@ -1,23 +1,87 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
-	ErrEditConflict = errors.New("Edit Conflict") 
+	ErrEditConflict = errors.New("Edit Conflict")
 )
 
+// MovieRepository is implemented by MovieModel, which stores movies in
+// PostgreSQL, and by the in-memory backend from NewMemoryModels.
+type MovieRepository interface {
+	Insert(ctx context.Context, movie *Movie) error
+	Get(ctx context.Context, id int64) (*Movie, error)
+	GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+	GetByTitleAndYear(ctx context.Context, title string, year int32) (*Movie, error)
+	Update(ctx context.Context, movie *Movie) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// UserRepository is implemented by UserModel and by the in-memory backend.
+type UserRepository interface {
+	Insert(ctx context.Context, user *User) error
+	Get(ctx context.Context, id int64) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetAll(ctx context.Context) ([]*User, error)
+	GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// PermissionRepository is implemented by PermissionModel and by the in-memory
+// backend.
+type PermissionRepository interface {
+	GetAll(ctx context.Context) (Permissions, error)
+	GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+	AddForUser(ctx context.Context, userID int64, codes ...string) error
+	RemoveForUser(ctx context.Context, userID int64, codes ...string) error
+}
+
+// TokenRepository is implemented by TokenModel and by the in-memory backend.
+type TokenRepository interface {
+	New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+	Insert(ctx context.Context, token *Token) error
+	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+}
+
+// JobRepository is implemented by JobModel and by the in-memory backend.
+type JobRepository interface {
+	Enqueue(ctx context.Context, job *Job) error
+	Claim(ctx context.Context, lease time.Duration) (*Job, error)
+	Complete(ctx context.Context, id int64) error
+	Fail(ctx context.Context, job *Job, jobErr error, retryAt time.Time) error
+	Retry(ctx context.Context, id int64) (*Job, error)
+	Get(ctx context.Context, id int64) (*Job, error)
+	GetAll(ctx context.Context, state string, filters Filters) ([]*Job, Metadata, error)
+}
+
+// Models holds the repositories used by the application. RateLimits only
+// works against PostgreSQL, so it is left as the concrete model, and has no
+// DB when the in-memory backend is in use.
 type Models struct {
-	Movies MovieModel
-	Users UserModel
+	Movies MovieRepository
+	Users UserRepository
+	RateLimits RateLimitModel
+	Permissions PermissionRepository
+	Tokens TokenRepository
+	Jobs JobRepository
+
+	tx txRunner
 }
 
-func NewModels(db *sql.DB) Models {
-	return Models{
-		Movies: MovieModel{DB: db},
-		Users: UserModel{DB: db},
-	}
+// NewModels returns Models backed by PostgreSQL. Every query is bounded by
+// the context it is given and by the matching entry in timeouts. Movie reads
+// go to replica while it's healthy; it may be nil if there isn't one.
+func NewModels(db *sql.DB, replica *Replica, timeouts Timeouts) Models {
+	models := withDB(db, timeouts, postgresTx{db: db, timeouts: timeouts})
+	// Models bound to a transaction don't get the replica, as reads in a
+	// transaction must see its own writes.
+	models.Movies = MovieModel{DB: traceDB(db, false), Replica: replica, Timeouts: timeouts}
+	return models
 }
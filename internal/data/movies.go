@@ -12,92 +12,88 @@ import (
 	"github.com/lib/pq"
 )
 
+// Movies are sent with the genres in "genre", but read from "genres", so
+// errors about them are keyed by "genres".
 type Movie struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genre,omitempty"`
+	Title     string    `json:"title" validate:"required,max=500"`
+	Year      int32     `json:"year,omitempty" validate:"required,min=1888"`
+	Runtime   Runtime   `json:"runtime,omitempty" validate:"required,min=1"`
+	Genres    []string  `json:"genre,omitempty" key:"genres" validate:"required,min=1,max=5,unique,dive,required"`
 	Version   int32     `json:"version,omitempty"`
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
-	v.Check(movie.Title != "", "title", "must be provided")
-	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes")
+	v.Struct(movie)
 
-	v.Check(movie.Year != 0, "year", "must be provided")
-	v.Check(movie.Year >= 1888, "year", "must greater than 1888")
-	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be the future")
-
-	v.Check(movie.Runtime != 0, "runtime", "must be provided")
-	v.Check(movie.Runtime > 0, "runtime", "mus tbe a positive integer")
-
-	v.Check(movie.Genres != nil, "genres", "must be provided")
-	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
-	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
-	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicates")
+	v.CheckCode(movie.Year <= int32(time.Now().Year()), "year", "future", "must not be in the future")
 }
 
+// MovieModel stores movies in PostgreSQL. When Replica is set, Get and GetAll
+// read from it while it's healthy; everything else uses DB.
 type MovieModel struct {
-	DB *sql.DB
+	DB       DBTX
+	Replica  *Replica
+	Timeouts Timeouts
 }
 
-func (m MovieModel) Insert(mv *Movie) error {
+func (m MovieModel) Insert(ctx context.Context, mv *Movie) error {
 	query := `
 Insert INTO movies (title, year, runtime, genres)
 VALUES ($1, $2, $3, $4)
 RETURNING id, created_at, version`
 
 	args := []interface{}{mv.Title, mv.Year, mv.Runtime, pq.Array(mv.Genres)}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 	return m.DB.QueryRowContext(ctx, query, args...).Scan(&mv.ID, &mv.CreatedAt, &mv.Version)
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m MovieModel) GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
 	query := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
 FROM movies
 WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 AND (genres @> $2 OR $2 = '{}')
 ORDER BY %s %s, id ASC
 LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
 	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, Metadata{}, err
-	}
-	defer rows.Close()
-
 	totalRecords := 0
+	var movies []*Movie
 
-	movies := []*Movie{}
-
-	for rows.Next() {
-		var movie Movie
-
-		err := rows.Scan(
-			&totalRecords,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-		)
+	err := m.Replica.read(ctx, m.DB, m.Timeouts.List, func(ctx context.Context, db DBTX) error {
+		rows, err := db.QueryContext(ctx, query, args...)
 		if err != nil {
-			return nil, Metadata{}, err
+			return err
 		}
-		movies = append(movies, &movie)
-	}
-	
-	if err = rows.Err(); err != nil {
+		defer rows.Close()
+
+		totalRecords = 0
+		movies = []*Movie{}
+
+		for rows.Next() {
+			var movie Movie
+
+			err := rows.Scan(
+				&totalRecords,
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Version,
+			)
+			if err != nil {
+				return err
+			}
+			movies = append(movies, &movie)
+		}
+		return rows.Err()
+	})
+	if err != nil {
 		return nil, Metadata{}, err
 	}
 
@@ -106,7 +102,7 @@ LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 	return movies, metadata, nil
 }
 
-func (m MovieModel) Get(id int64) (*Movie, error) {
+func (m MovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
 	// The psql bigserial data type that wer're using to store id
 	// is auto incrementing from 1 by default, less than 1 is not possible
 	if id < 1 {
@@ -117,18 +113,18 @@ SELECT id, created_at, title, year, runtime, genres, version
 FROM movies
 WHERE id = $1`
 	var movie Movie
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
-	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&movie.ID,
-		&movie.CreatedAt,
-		&movie.Title,
-		&movie.Year,
-		&movie.Runtime,
-		pq.Array(&movie.Genres),
-		&movie.Version,
-	)
+	err := m.Replica.read(ctx, m.DB, m.Timeouts.Read, func(ctx context.Context, db DBTX) error {
+		return db.QueryRowContext(ctx, query, id).Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -140,7 +136,7 @@ WHERE id = $1`
 	return &movie, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+func (m MovieModel) Update(ctx context.Context, movie *Movie) error {
 	query := `
 UPDATE movies
 SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
@@ -155,7 +151,7 @@ RETURNING version`
 		movie.ID,
 		movie.Version,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
@@ -169,13 +165,13 @@ RETURNING version`
 	return nil
 }
 
-func (m MovieModel) Delete(id int64) error {
+func (m MovieModel) Delete(ctx context.Context, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `DELETE FROM movies where id = $1`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 
 	result, err := m.DB.ExecContext(ctx, query, id)
@@ -192,3 +188,37 @@ func (m MovieModel) Delete(id int64) error {
 	}
 	return nil
 }
+
+// GetByTitleAndYear returns the movie with exactly the given title and year.
+// It's used to recognise movies which have already been loaded from a
+// fixture file, as there's no other natural key for a movie.
+func (m MovieModel) GetByTitleAndYear(ctx context.Context, title string, year int32) (*Movie, error) {
+	query := `
+SELECT id, created_at, title, year, runtime, genres, version
+FROM movies
+WHERE title = $1 AND year = $2
+ORDER BY id
+LIMIT 1`
+	var movie Movie
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, title, year).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+)
+
+// Permissions holds the permission codes, like "movies:read", granted to a
+// single user.
+type Permissions []string
+
+// Include reports whether a specific permission code is in the slice.
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+type PermissionModel struct {
+	DB       DBTX
+	Timeouts Timeouts
+}
+
+// GetAll returns every permission code that can be granted.
+func (m PermissionModel) GetAll(ctx context.Context) (Permissions, error) {
+	query := `SELECT code FROM permissions ORDER BY code`
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	return m.queryCodes(ctx, query)
+}
+
+// GetAllForUser returns the permission codes granted to the given user.
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	query := `
+SELECT permissions.code
+FROM permissions
+INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+WHERE users_permissions.user_id = $1
+ORDER BY permissions.code`
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.List)
+	defer cancel()
+
+	return m.queryCodes(ctx, query, userID)
+}
+
+// AddForUser grants the given permission codes to a user. Codes the user
+// already has are left alone. If any of the codes doesn't exist nothing is
+// granted and ErrUnknownPermission is returned.
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+ON CONFLICT DO NOTHING`
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	if err := m.checkCodes(ctx, codes); err != nil {
+		return err
+	}
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+// RemoveForUser revokes the given permission codes from a user.
+func (m PermissionModel) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `
+DELETE FROM users_permissions
+USING permissions
+WHERE users_permissions.permission_id = permissions.id
+AND users_permissions.user_id = $1
+AND permissions.code = ANY($2)`
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	if err := m.checkCodes(ctx, codes); err != nil {
+		return err
+	}
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+// checkCodes returns ErrUnknownPermission if any of codes isn't in the
+// permissions table.
+func (m PermissionModel) checkCodes(ctx context.Context, codes []string) error {
+	query := `SELECT count(DISTINCT code) FROM permissions WHERE code = ANY($1)`
+
+	unique := make(map[string]bool)
+	for _, code := range codes {
+		unique[code] = true
+	}
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, pq.Array(codes)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count != len(unique) {
+		return ErrUnknownPermission
+	}
+	return nil
+}
+
+func (m PermissionModel) queryCodes(ctx context.Context, query string, args ...interface{}) (Permissions, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
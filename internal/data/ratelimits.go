@@ -0,0 +1,90 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RateLimitModel keeps rate limiter token buckets in the rate_limits table so
+// that every API instance sharing the database enforces the same limits.
+type RateLimitModel struct {
+	DB       DBTX
+	Timeouts Timeouts
+}
+
+// Allow takes a token from the bucket for key, refilling it at rps tokens per
+// second up to a maximum of burst first. It reports whether a token was
+// available and how many tokens are left in the bucket afterwards.
+func (m RateLimitModel) Allow(ctx context.Context, key string, rps float64, burst int) (bool, float64, error) {
+	// The refill is calculated from the row locked by the sub-query, so
+	// concurrent requests for the same key queue up on the row lock rather
+	// than both spending the same token.
+	query := `
+UPDATE rate_limits AS rl
+SET tokens = CASE WHEN b.refill >= 1 THEN b.refill - 1 ELSE b.refill END,
+	updated_at = b.now
+FROM (
+	SELECT key, clock_timestamp() AS now,
+		LEAST($3, tokens + EXTRACT(EPOCH FROM clock_timestamp() - updated_at) * $2) AS refill
+	FROM rate_limits
+	WHERE key = $1
+	FOR UPDATE
+) AS b
+WHERE rl.key = b.key
+RETURNING b.refill >= 1, rl.tokens`
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.RateLimit)
+	defer cancel()
+
+	var allowed bool
+	var tokens float64
+
+	for {
+		err := m.DB.QueryRowContext(ctx, query, key, rps, burst).Scan(&allowed, &tokens)
+		if err == nil {
+			return allowed, tokens, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return false, 0, err
+		}
+
+		// This is the first request from the client, so start it off with
+		// a full bucket less the token for this request. If another
+		// instance inserted the row in the meantime, go round again and
+		// update that one instead.
+		insert := `
+INSERT INTO rate_limits (key, tokens)
+VALUES ($1, $2)
+ON CONFLICT (key) DO NOTHING`
+
+		result, err := m.DB.ExecContext(ctx, insert, key, float64(burst-1))
+		if err != nil {
+			return false, 0, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return false, 0, err
+		}
+		if rowsAffected == 1 {
+			return true, float64(burst - 1), nil
+		}
+	}
+}
+
+// DeleteStale removes the buckets which haven't been used for longer than age.
+// age should be at least the time the slowest tier takes to refill a bucket,
+// so that forgetting one doesn't change the outcome of the client's next
+// request.
+func (m RateLimitModel) DeleteStale(ctx context.Context, age time.Duration) error {
+	query := `
+DELETE FROM rate_limits
+WHERE updated_at < clock_timestamp() - $1 * INTERVAL '1 second'`
+
+	ctx, cancel := withTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, age.Seconds())
+	return err
+}
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Replica is a pool of connections to a read replica of the primary database.
+// Models send reads to it while it is healthy and to the primary otherwise. It
+// starts out unhealthy; call Check to find out if it can be used.
+type Replica struct {
+	db      *sql.DB
+	healthy int32
+}
+
+func NewReplica(db *sql.DB) *Replica {
+	return &Replica{db: db}
+}
+
+// Healthy reports whether reads are currently being sent to the replica.
+func (r *Replica) Healthy() bool {
+	return r != nil && atomic.LoadInt32(&r.healthy) == 1
+}
+
+// Check pings the replica and marks it healthy or unhealthy to match,
+// returning the error from the ping.
+func (r *Replica) Check(ctx context.Context) error {
+	err := r.db.PingContext(ctx)
+	r.setHealthy(err == nil)
+	return err
+}
+
+func (r *Replica) setHealthy(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	atomic.StoreInt32(&r.healthy, v)
+}
+
+type primaryContextKey struct{}
+
+// UsePrimary returns a copy of ctx which makes the models read from the
+// primary even when there is a healthy replica. Use it when reading a record
+// that is about to be written, or that has just been, so that replication lag
+// can't return a stale copy.
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// readDB returns the replica's pool if a read with ctx should go to it, or nil
+// if it should go to the primary.
+func (r *Replica) readDB(ctx context.Context) DBTX {
+	if !r.Healthy() || ctx.Value(primaryContextKey{}) != nil {
+		return nil
+	}
+	return traceDB(r.db, true)
+}
+
+// read runs fn on the replica if it should be used, and on primary if not,
+// giving each attempt up to timeout. If the replica fails for any reason but a
+// missing row or the end of ctx, it is marked unhealthy until the next
+// successful Check and fn is run again on primary.
+func (r *Replica) read(ctx context.Context, primary DBTX, timeout time.Duration, fn func(ctx context.Context, db DBTX) error) error {
+	attempt := func(db DBTX) error {
+		ctx, cancel := withTimeout(ctx, timeout)
+		defer cancel()
+		return fn(ctx, db)
+	}
+
+	if db := r.readDB(ctx); db != nil {
+		err := attempt(db)
+		if err == nil || errors.Is(err, sql.ErrNoRows) || ctx.Err() != nil {
+			return err
+		}
+		r.setHealthy(false)
+	}
+	return attempt(primary)
+}
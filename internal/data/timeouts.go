@@ -0,0 +1,35 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts caps how long each kind of query may run. The context passed to a
+// model method can end a query sooner, for example when the client that made
+// the request goes away. A zero duration means the query is only bounded by
+// that context.
+type Timeouts struct {
+	Read      time.Duration // single record lookups
+	List      time.Duration // queries returning many rows, like Movies.GetAll
+	Write     time.Duration // inserts, updates and deletes
+	RateLimit time.Duration // rate limiter bucket updates, done on every request
+}
+
+// DefaultTimeouts returns the timeouts used when none are configured.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Read:      3 * time.Second,
+		List:      3 * time.Second,
+		Write:     3 * time.Second,
+		RateLimit: time.Second,
+	}
+}
+
+// withTimeout returns a child of ctx which expires after d, unless d is zero.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/jahidhimon/greenlight.git/internal/tracing"
+)
+
+// tracedDB runs queries on db, each in a span of its own. Queries are only
+// traced as part of a larger operation, such as a request, so that the job
+// workers' polling doesn't start a new trace every second.
+type tracedDB struct {
+	db      DBTX
+	replica bool
+}
+
+func traceDB(db DBTX, replica bool) DBTX {
+	return tracedDB{db: db, replica: replica}
+}
+
+// tableRX finds the table a query works on, for the span name.
+var tableRX = regexp.MustCompile(`(?is)\b(?:from|into|update)\s+([a-z_][a-z0-9_.]*)`)
+
+// start starts a span named after the query's operation and table, such as
+// "SELECT movies", which is how OpenTelemetry names database spans.
+func (t tracedDB) start(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	if tracing.SpanFromContext(ctx) == nil {
+		return ctx, nil
+	}
+
+	statement := strings.Join(strings.Fields(query), " ")
+	name := statement
+	if i := strings.Index(name, " "); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ToUpper(name)
+	if m := tableRX.FindStringSubmatch(statement); m != nil {
+		name += " " + m[1]
+	}
+
+	ctx, span := tracing.Start(ctx, name, tracing.KindClient)
+	span.SetAttributes(
+		tracing.String("db.system", "postgresql"),
+		tracing.String("db.statement", statement),
+		tracing.Bool("db.replica", t.replica),
+	)
+	return ctx, span
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	result, err := t.db.ExecContext(ctx, query, args...)
+	span.RecordError(err)
+	return result, err
+}
+
+// The span for QueryContext covers running the query, not reading the rows.
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	span.RecordError(err)
+	return rows, err
+}
+
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	row := t.db.QueryRowContext(ctx, query, args...)
+	// A missing row isn't known until Scan, and isn't a failure anyway.
+	if err := row.Err(); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+	}
+	return row
+}
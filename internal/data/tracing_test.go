@@ -0,0 +1,82 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jahidhimon/greenlight.git/internal/tracing"
+)
+
+// failingDB is a DBTX whose queries all fail with err.
+type failingDB struct {
+	err error
+}
+
+func (db failingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, db.err
+}
+
+func (db failingDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, db.err
+}
+
+func (db failingDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestTracedDB(t *testing.T) {
+	exporter := &tracing.MemoryExporter{}
+	tracing.SetDefault(tracing.New(exporter, "test", 1))
+	t.Cleanup(func() { tracing.SetDefault(nil) })
+
+	errBoom := errors.New("boom")
+	db := traceDB(failingDB{err: errBoom}, false)
+
+	// Queries outside a trace aren't recorded.
+	db.ExecContext(context.Background(), "DELETE FROM movies WHERE id = $1", 1)
+	if spans := exporter.Spans(); len(spans) != 0 {
+		t.Fatalf("got %+v", spans)
+	}
+
+	ctx, parent := tracing.Start(context.Background(), "GET /v1/movies", tracing.KindServer)
+	db.ExecContext(ctx, "DELETE FROM movies WHERE id = $1", 1)
+	db.QueryContext(ctx, `
+SELECT count(*) OVER(), id
+FROM movies`)
+	parent.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans; want 3", len(spans))
+	}
+	del, sel := spans[0], spans[1]
+	if del.Name != "DELETE movies" || sel.Name != "SELECT movies" {
+		t.Errorf("got span names %q and %q", del.Name, sel.Name)
+	}
+	if del.Kind != tracing.KindClient || del.Status != "error" || del.StatusMessage != "boom" {
+		t.Errorf("got %+v", del)
+	}
+	if del.ParentSpanID != spans[2].SpanID || del.TraceID != spans[2].TraceID {
+		t.Errorf("the query span isn't a child of the request's")
+	}
+	if got := sel.Attributes["db.statement"]; got != "SELECT count(*) OVER(), id FROM movies" {
+		t.Errorf("got db.statement %q", got)
+	}
+}
+
+func TestTransactionSpan(t *testing.T) {
+	exporter := &tracing.MemoryExporter{}
+	tracing.SetDefault(tracing.New(exporter, "test", 1))
+	t.Cleanup(func() { tracing.SetDefault(nil) })
+
+	errBoom := errors.New("boom")
+	models := NewMemoryModels()
+	models.Transaction(context.Background(), func(tx Models) error { return errBoom })
+
+	spans := exporter.Spans()
+	if len(spans) != 1 || spans[0].Name != "transaction" || spans[0].Status != "error" {
+		t.Errorf("got %+v", spans)
+	}
+}
@@ -0,0 +1,174 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jahidhimon/greenlight.git/internal/tracing"
+	"github.com/lib/pq"
+)
+
+// maxTxAttempts is how many times Transaction runs a function whose
+// transaction keeps failing with a serialization failure or deadlock.
+const maxTxAttempts = 5
+
+// DBTX is the part of *sql.DB and *sql.Tx used by the models, so that the same
+// model can run its queries on the connection pool or inside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// txRunner starts transactions for a Models. Each backend has its own.
+type txRunner interface {
+	transaction(ctx context.Context, fn func(tx Models) error) error
+}
+
+// Transaction runs fn with a copy of the models whose queries all happen in a
+// single transaction. The transaction is committed if fn returns nil and
+// rolled back if it returns an error or panics; a panic is passed on after the
+// rollback.
+//
+// Transactions use the serializable isolation level. When PostgreSQL aborts
+// one with a serialization failure or a deadlock, fn is run again in a new
+// transaction, up to maxTxAttempts times, so fn must not have side effects
+// other than through the models it is given.
+//
+// Calling Transaction on the models passed to fn starts a nested transaction
+// using a savepoint. If the inner fn fails, only its changes are rolled back
+// and the error is returned to the outer fn, which can carry on.
+func (m Models) Transaction(ctx context.Context, fn func(tx Models) error) error {
+	if m.tx == nil {
+		return errors.New("data: models don't support transactions")
+	}
+
+	ctx, span := tracing.Start(ctx, "transaction", tracing.KindInternal)
+	defer span.End()
+
+	err := m.tx.transaction(ctx, fn)
+	span.RecordError(err)
+	return err
+}
+
+// withDB returns models which run their queries on db, tracing each one.
+func withDB(db DBTX, timeouts Timeouts, tx txRunner) Models {
+	db = traceDB(db, false)
+	return Models{
+		Movies:      MovieModel{DB: db, Timeouts: timeouts},
+		Users:       UserModel{DB: db, Timeouts: timeouts},
+		RateLimits:  RateLimitModel{DB: db, Timeouts: timeouts},
+		Permissions: PermissionModel{DB: db, Timeouts: timeouts},
+		Tokens:      TokenModel{DB: db, Timeouts: timeouts},
+		Jobs:        JobModel{DB: db, Timeouts: timeouts},
+		tx:          tx,
+	}
+}
+
+// postgresTx starts transactions on db. Once a transaction is open, tx is set
+// and depth counts the savepoints inside it.
+type postgresTx struct {
+	db       *sql.DB
+	tx       *sql.Tx
+	depth    int
+	timeouts Timeouts
+}
+
+func (p postgresTx) transaction(ctx context.Context, fn func(tx Models) error) error {
+	if p.tx != nil {
+		return p.savepoint(ctx, fn)
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = p.attempt(ctx, fn)
+		if !isRetryable(err) || attempt == maxTxAttempts {
+			break
+		}
+
+		// Back off for a random time which grows with each attempt, so
+		// that the transactions which clashed don't clash again.
+		backoff := time.Duration(rand.Int63n(int64(10*time.Millisecond) << attempt))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// attempt runs fn in a single transaction.
+func (p postgresTx) attempt(ctx context.Context, fn func(tx Models) error) (err error) {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			tx.Rollback()
+			panic(v)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	inner := postgresTx{db: p.db, tx: tx, timeouts: p.timeouts}
+	if err = fn(withDB(tx, p.timeouts, inner)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// savepoint runs fn inside the open transaction, and rolls back to a
+// savepoint taken beforehand if it fails.
+func (p postgresTx) savepoint(ctx context.Context, fn func(tx Models) error) (err error) {
+	name := fmt.Sprintf("sp_%d", p.depth+1)
+
+	if _, err = p.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	defer func() {
+		v := recover()
+		if v != nil || err != nil {
+			// The context may be the reason fn failed, so don't let it
+			// stop the rollback as well.
+			_, rbErr := p.tx.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT "+name)
+			if v != nil {
+				panic(v)
+			}
+			if rbErr != nil {
+				err = fmt.Errorf("%w (rolling back to savepoint: %v)", err, rbErr)
+			}
+		}
+	}()
+
+	inner := postgresTx{db: p.db, tx: p.tx, depth: p.depth + 1, timeouts: p.timeouts}
+	if err = fn(withDB(p.tx, p.timeouts, inner)); err != nil {
+		return err
+	}
+
+	_, err = p.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
+// isRetryable reports whether err means PostgreSQL gave up on the transaction
+// because of concurrent transactions, so that running it again may succeed.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "40001", // serialization_failure
+			"40P01": // deadlock_detected
+			return true
+		}
+	}
+	return false
+}
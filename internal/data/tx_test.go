@@ -0,0 +1,108 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func newTestMovie(title string) *Movie {
+	return &Movie{Title: title, Year: 2016, Runtime: 107, Genres: []string{"animation"}}
+}
+
+func countMovies(t *testing.T, models Models) int {
+	t.Helper()
+
+	_, metadata, err := models.Movies.GetAll(context.Background(), "", nil,
+		Filters{Page: 1, PageSize: 100, Sort: "id", SortSafeList: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.TotalRecords
+}
+
+func TestMemoryTransaction(t *testing.T) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	t.Run("commit", func(t *testing.T) {
+		models := NewMemoryModels()
+
+		err := models.Transaction(ctx, func(tx Models) error {
+			return tx.Movies.Insert(ctx, newTestMovie("Moana"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := countMovies(t, models); n != 1 {
+			t.Errorf("got %d movies; want 1", n)
+		}
+	})
+
+	t.Run("rollback on error", func(t *testing.T) {
+		models := NewMemoryModels()
+
+		err := models.Transaction(ctx, func(tx Models) error {
+			if err := tx.Movies.Insert(ctx, newTestMovie("Moana")); err != nil {
+				return err
+			}
+			return errBoom
+		})
+		if !errors.Is(err, errBoom) {
+			t.Fatalf("got error %v; want %v", err, errBoom)
+		}
+		if n := countMovies(t, models); n != 0 {
+			t.Errorf("got %d movies; want 0", n)
+		}
+	})
+
+	t.Run("rollback on panic", func(t *testing.T) {
+		models := NewMemoryModels()
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("panic was swallowed")
+				}
+			}()
+			models.Transaction(ctx, func(tx Models) error {
+				tx.Movies.Insert(ctx, newTestMovie("Moana"))
+				panic("boom")
+			})
+		}()
+
+		if n := countMovies(t, models); n != 0 {
+			t.Errorf("got %d movies; want 0", n)
+		}
+	})
+
+	t.Run("nested rollback", func(t *testing.T) {
+		models := NewMemoryModels()
+
+		err := models.Transaction(ctx, func(tx Models) error {
+			if err := tx.Movies.Insert(ctx, newTestMovie("Moana")); err != nil {
+				return err
+			}
+
+			err := tx.Transaction(ctx, func(tx Models) error {
+				tx.Movies.Insert(ctx, newTestMovie("Frozen"))
+				return errBoom
+			})
+			if !errors.Is(err, errBoom) {
+				t.Errorf("got nested error %v; want %v", err, errBoom)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movie, err := models.Movies.Get(ctx, 1)
+		if err != nil || movie.Title != "Moana" {
+			t.Errorf("got %v, %v; want Moana", movie, err)
+		}
+		if n := countMovies(t, models); n != 1 {
+			t.Errorf("got %d movies; want 1", n)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package greenlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Field is a key and value added to a log entry. Values keep their type in
+// JSON output, so numbers and booleans can be queried as such.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration is written as a string such as "1.5s".
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err adds an error under the key "error". A nil error is written as null.
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// Any adds a value of any type which encoding/json can handle.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// value returns the field's value as it should be encoded.
+func (f Field) value() interface{} {
+	switch v := f.Value.(type) {
+	case time.Duration:
+		return v.String()
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case json.Marshaler:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// mapFields turns the properties of the Print methods into fields, in key
+// order so that entries are written the same way every time.
+func mapFields(properties map[string]string) []Field {
+	if len(properties) == 0 {
+		return nil
+	}
+	fields := make([]Field, 0, len(properties))
+	for key, value := range properties {
+		fields = append(fields, String(key, value))
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+	return fields
+}
+
+// merge returns the fields of a logger followed by the fields of a call. A
+// key given more than once keeps its first position and its last value.
+func merge(base, fields []Field) []Field {
+	if len(base) == 0 && len(fields) == 0 {
+		return nil
+	}
+	merged := make([]Field, 0, len(base)+len(fields))
+	index := make(map[string]int, len(base)+len(fields))
+	for _, list := range [][]Field{base, fields} {
+		for _, f := range list {
+			if i, ok := index[f.Key]; ok {
+				merged[i] = f
+				continue
+			}
+			index[f.Key] = len(merged)
+			merged = append(merged, f)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,173 @@
+package greenlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Format is how log entries are written.
+type Format int8
+
+const (
+	// FormatJSON writes one JSON object per line, for log collectors.
+	FormatJSON Format = iota
+	// FormatLogfmt writes key=value pairs, which are easy to grep.
+	FormatLogfmt
+	// FormatConsole writes the time, level and message first and the
+	// fields after them, for reading in a terminal during development.
+	FormatConsole
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatLogfmt:
+		return "logfmt"
+	case FormatConsole:
+		return "console"
+	default:
+		return ""
+	}
+}
+
+// ParseFormat converts a format name such as "json" into a Format.
+func ParseFormat(s string) (Format, error) {
+	for f := FormatJSON; f <= FormatConsole; f++ {
+		if strings.EqualFold(s, f.String()) {
+			return f, nil
+		}
+	}
+	return FormatJSON, fmt.Errorf("unknown log format %q", s)
+}
+
+// entry is a log entry on its way to being written.
+type entry struct {
+	level   Level
+	time    time.Time
+	message string
+	fields  []Field
+	trace   string
+}
+
+// encode returns e as a line of output, ending in a newline.
+func (f Format) encode(e entry) []byte {
+	switch f {
+	case FormatLogfmt:
+		return encodeLogfmt(e)
+	case FormatConsole:
+		return encodeConsole(e)
+	default:
+		return encodeJSON(e)
+	}
+}
+
+// encodeJSON writes the level, time and message, then the fields in a
+// "properties" object in the order they were added, then any trace.
+func encodeJSON(e entry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"level":`)
+	writeJSONValue(&buf, e.level.String())
+	buf.WriteString(`,"time":`)
+	writeJSONValue(&buf, e.time.Format(time.RFC3339))
+	buf.WriteString(`,"message":`)
+	writeJSONValue(&buf, e.message)
+
+	if len(e.fields) > 0 {
+		buf.WriteString(`,"properties":{`)
+		for i, f := range e.fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONValue(&buf, f.Key)
+			buf.WriteByte(':')
+			writeJSONValue(&buf, f.value())
+		}
+		buf.WriteByte('}')
+	}
+
+	if e.trace != "" {
+		buf.WriteString(`,"trace":`)
+		writeJSONValue(&buf, e.trace)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// writeJSONValue writes v as JSON, or as a JSON string of its fmt form if
+// encoding/json can't handle it, so one bad field doesn't lose the entry.
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%+v", v))
+	}
+	buf.Write(b)
+}
+
+func encodeLogfmt(e entry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("time=")
+	buf.WriteString(e.time.Format(time.RFC3339))
+	buf.WriteString(" level=")
+	buf.WriteString(e.level.String())
+	buf.WriteString(" message=")
+	buf.WriteString(logfmtValue(e.message))
+	for _, f := range e.fields {
+		writeLogfmtField(&buf, f)
+	}
+	if e.trace != "" {
+		buf.WriteString(" trace=")
+		buf.WriteString(logfmtValue(e.trace))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func encodeConsole(e entry) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %-5s %s", e.time.Format("15:04:05"), e.level, e.message)
+	for _, f := range e.fields {
+		writeLogfmtField(&buf, f)
+	}
+	buf.WriteByte('\n')
+	// The trace is written as it is, so it reads like a panic's.
+	if e.trace != "" {
+		buf.WriteString(strings.TrimRight(e.trace, "\n"))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func writeLogfmtField(buf *bytes.Buffer, f Field) {
+	buf.WriteByte(' ')
+	buf.WriteString(f.Key)
+	buf.WriteByte('=')
+
+	switch v := f.value().(type) {
+	case string:
+		buf.WriteString(logfmtValue(v))
+	case nil:
+		buf.WriteString("null")
+	default:
+		buf.WriteString(logfmtValue(fmt.Sprintf("%+v", v)))
+	}
+}
+
+// logfmtValue quotes s if it's empty or has spaces, quotes, '=' or control
+// characters in it.
+func logfmtValue(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r == ' ' || r == '"' || r == '=' || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
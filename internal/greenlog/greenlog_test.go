@@ -0,0 +1,158 @@
+package greenlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		want Level
+	}{
+		{"debug", LevelDebug},
+		{"INFO", LevelInfo},
+		{"Warn", LevelWarn},
+		{"warning", LevelWarn},
+		{"error", LevelError},
+		{"FATAL", LevelFatal},
+		{"off", LevelOff},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.name)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("got no error for an unknown level")
+	}
+}
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelWarn)
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn")
+	if got := strings.Count(buf.String(), "\n"); got != 1 {
+		t.Fatalf("got %d entries; want only the WARN one:\n%s", got, buf.String())
+	}
+
+	// Children share their parent's level.
+	child := logger.With(String("a", "b"))
+	logger.SetLevel(LevelDebug)
+	child.Debug("debug")
+	if got := strings.Count(buf.String(), "\n"); got != 2 || !child.Enabled(LevelDebug) {
+		t.Errorf("the child didn't follow its parent's level:\n%s", buf.String())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelInfo).With(String("request_id", "abc"), Int64("user_id", 7))
+
+	logger.Error(errors.New("boom"),
+		Int("attempt", 2),
+		Duration("took", 1500*time.Millisecond),
+		Err(errors.New("cause")),
+		String("request_id", "def"),
+	)
+
+	var got struct {
+		Level      string                 `json:"level"`
+		Message    string                 `json:"message"`
+		Properties map[string]interface{} `json:"properties"`
+		Trace      string                 `json:"trace"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%v in %s", err, buf.String())
+	}
+	if got.Level != "ERROR" || got.Message != "boom" || got.Trace == "" {
+		t.Errorf("got %+v", got)
+	}
+
+	want := map[string]interface{}{
+		"request_id": "def",
+		"user_id":    float64(7),
+		"attempt":    float64(2),
+		"took":       "1.5s",
+		"error":      "cause",
+	}
+	for key, value := range want {
+		if got.Properties[key] != value {
+			t.Errorf("got %s = %#v; want %#v", key, got.Properties[key], value)
+		}
+	}
+
+	// Fields are written in the order they were added, with a repeated key
+	// in its first place.
+	line := buf.String()
+	if !(strings.Index(line, `"request_id"`) < strings.Index(line, `"user_id"`) &&
+		strings.Index(line, `"user_id"`) < strings.Index(line, `"attempt"`)) {
+		t.Errorf("fields out of order: %s", line)
+	}
+}
+
+func TestStackLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelInfo)
+	logger.SetStackLevel(LevelOff)
+
+	logger.PrintError(errors.New("boom"), map[string]string{"b": "2", "a": "1"})
+	if strings.Contains(buf.String(), "trace") {
+		t.Errorf("got a stack trace: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"properties":{"a":"1","b":"2"}`) {
+		t.Errorf("got %s", buf.String())
+	}
+
+	buf.Reset()
+	logger.SetStackLevel(LevelWarn)
+	logger.Warn("careful")
+	if !strings.Contains(buf.String(), `"trace":"goroutine`) {
+		t.Errorf("got no stack trace: %s", buf.String())
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelInfo)
+	logger.SetFormat(FormatLogfmt)
+
+	logger.Info("starting server", String("addr", ":4000"), String("env", "dev mode"), Bool("tls", false), Err(nil))
+
+	line := buf.String()
+	if !strings.HasPrefix(line, "time=") {
+		t.Errorf("got %q", line)
+	}
+	want := ` level=INFO message="starting server" addr=:4000 env="dev mode" tls=false error=null` + "\n"
+	if !strings.HasSuffix(line, want) {
+		t.Errorf("got %q; want it to end with %q", line, want)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelInfo)
+	logger.SetFormat(FormatConsole)
+
+	logger.Error(errors.New("boom"), Int("status", 500))
+
+	lines := strings.SplitN(buf.String(), "\n", 2)
+	if !strings.HasSuffix(lines[0], " ERROR boom status=500") {
+		t.Errorf("got %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "goroutine ") {
+		t.Errorf("got no stack trace after the entry: %q", lines[1])
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("got no error for an unknown format")
+	}
+}
@@ -1,10 +1,11 @@
 package greenlog
 
 import (
-	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,84 +13,224 @@ import (
 type Level int8
 
 const (
-	LevelInfo  Level = iota // Has the value 0
-	LevelError              // Has the value 1
-	LevelFatal              // Has the value 2
-	LevelOff                // Has the value 3
+	LevelDebug Level = iota - 1 // Has the value -1
+	LevelInfo                   // Has the value 0
+	LevelWarn                   // Has the value 1
+	LevelError                  // Has the value 2
+	LevelFatal                  // Has the value 3
+	LevelOff                    // Has the value 4
 )
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
 		return "FATAL"
+	case LevelOff:
+		return "OFF"
 	default:
 		return ""
 	}
 }
 
+// ParseLevel converts a level name such as "INFO" or "error" into a Level.
+// "WARNING" is accepted as well as "WARN".
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	if strings.EqualFold(s, "WARNING") {
+		return LevelWarn, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// Greenlog writes log entries at or above a minimum level to one or more
+// sinks. Loggers made by With share their parent's sinks and settings, so
+// changing the level of one changes it for all of them.
 type Greenlog struct {
-	out      io.Writer
-	minLevel Level
-	mu       sync.Mutex
+	core   *core
+	fields []Field
+}
+
+// core is the state shared by a logger and its children.
+type core struct {
+	mu         sync.Mutex
+	sinks      []Sink
+	minLevel   Level
+	stackLevel Level
+	sampler    *sampler
 }
 
+// New returns a logger which writes JSON entries to out. Entries at the
+// ERROR level and above include a stack trace. More sinks can be added with
+// AddSink.
 func New(out io.Writer, minLevel Level) *Greenlog {
 	return &Greenlog{
-		out:      out,
-		minLevel: minLevel,
+		core: &core{
+			sinks:      []Sink{{Out: out, MinLevel: LevelDebug, Format: FormatJSON}},
+			minLevel:   minLevel,
+			stackLevel: LevelError,
+		},
 	}
 }
 
+// With returns a child logger which adds fields to every entry, ahead of
+// the fields passed to each call. It's used to tag everything logged while
+// handling a request with the request's ID, for example.
+func (gl *Greenlog) With(fields ...Field) *Greenlog {
+	child := &Greenlog{core: gl.core}
+	child.fields = append(child.fields, gl.fields...)
+	child.fields = append(child.fields, fields...)
+	return child
+}
+
+// SetLevel changes the minimum level of entries that will be written. It is
+// safe to call while other goroutines are logging.
+func (gl *Greenlog) SetLevel(level Level) {
+	gl.core.mu.Lock()
+	defer gl.core.mu.Unlock()
+	gl.core.minLevel = level
+}
+
+// Level returns the current minimum level.
+func (gl *Greenlog) Level() Level {
+	gl.core.mu.Lock()
+	defer gl.core.mu.Unlock()
+	return gl.core.minLevel
+}
+
+// SetStackLevel changes the lowest level of entries which include a stack
+// trace. LevelOff turns stack traces off.
+func (gl *Greenlog) SetStackLevel(level Level) {
+	gl.core.mu.Lock()
+	defer gl.core.mu.Unlock()
+	gl.core.stackLevel = level
+}
+
+// SetFormat changes how entries are written to the out given to New. Sinks
+// added with AddSink keep their own formats.
+func (gl *Greenlog) SetFormat(format Format) {
+	gl.core.mu.Lock()
+	defer gl.core.mu.Unlock()
+	gl.core.sinks[0].Format = format
+}
+
+// Enabled reports whether entries at level would be written, so that
+// callers can skip working out fields for entries which would be dropped.
+func (gl *Greenlog) Enabled(level Level) bool {
+	return level >= gl.Level()
+}
+
 // Helper methods
 
+func (gl *Greenlog) Debug(message string, fields ...Field) {
+	gl.print(LevelDebug, message, fields)
+}
+
+func (gl *Greenlog) Info(message string, fields ...Field) {
+	gl.print(LevelInfo, message, fields)
+}
+
+func (gl *Greenlog) Warn(message string, fields ...Field) {
+	gl.print(LevelWarn, message, fields)
+}
+
+func (gl *Greenlog) Error(err error, fields ...Field) {
+	gl.print(LevelError, err.Error(), fields)
+}
+
+func (gl *Greenlog) Fatal(err error, fields ...Field) {
+	gl.print(LevelFatal, err.Error(), fields)
+	os.Exit(1) // For entries at the FATAL level, we also terminate the application
+}
+
+// The Print methods take string properties, as the logger did before it had
+// typed fields.
+
+func (gl *Greenlog) PrintDebug(message string, properties map[string]string) {
+	gl.print(LevelDebug, message, mapFields(properties))
+}
+
 func (gl *Greenlog) PrintInfo(message string, properties map[string]string) {
-	gl.print(LevelInfo, message, properties)
+	gl.print(LevelInfo, message, mapFields(properties))
+}
+
+func (gl *Greenlog) PrintWarn(message string, properties map[string]string) {
+	gl.print(LevelWarn, message, mapFields(properties))
 }
 
 func (gl *Greenlog) PrintError(err error, properties map[string]string) {
-	gl.print(LevelError, err.Error(), properties)
+	gl.print(LevelError, err.Error(), mapFields(properties))
 }
 
 func (gl *Greenlog) PrintFatal(err error, properties map[string]string) {
-	gl.print(LevelFatal, err.Error(), properties)
-	os.Exit(1) // For entries at the FATAL level, we also terminate the application
+	gl.print(LevelFatal, err.Error(), mapFields(properties))
+	os.Exit(1)
 }
 
-func (glog *Greenlog) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < glog.minLevel {
+// print writes an entry to each sink which wants it. It returns what the
+// last of them returned, or the first error.
+func (gl *Greenlog) print(level Level, message string, fields []Field) (int, error) {
+	c := gl.core
+	c.mu.Lock()
+	minLevel, stackLevel, sampler := c.minLevel, c.stackLevel, c.sampler
+	c.mu.Unlock()
+
+	if level < minLevel {
 		return 0, nil
 	}
-	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
-	}{
-		Level:      level.String(),
-		Time:       time.Now().Format(time.RFC3339),
-		Message:    message,
-		Properties: properties,
+	now := time.Now()
+	if sampler != nil && !sampler.allow(level, message, now) {
+		return 0, nil
 	}
-	// Include a stack trace for entries at the ERROR and FATAL levels.
-	if level >= LevelError {
-		aux.Trace = string(debug.Stack())
+
+	e := entry{
+		level:   level,
+		time:    now,
+		message: message,
+		fields:  merge(gl.fields, fields),
 	}
-	var line []byte
-	line, err := json.Marshal(aux)
-	if err != nil {
-		line = []byte(LevelError.String() + ": unable to marshal log message" + err.Error())
+	if level >= stackLevel {
+		e.trace = string(debug.Stack())
 	}
-	glog.mu.Lock()
-	defer glog.mu.Unlock()
 
-	return glog.out.Write(append(line, '\n'))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Each format is only encoded once, however many sinks use it.
+	var lines [FormatConsole + 1][]byte
+	var n int
+	var firstErr error
+	for _, s := range c.sinks {
+		if level < s.MinLevel {
+			continue
+		}
+		format := s.Format
+		if format < FormatJSON || format > FormatConsole {
+			format = FormatJSON
+		}
+		if lines[format] == nil {
+			lines[format] = format.encode(e)
+		}
+		written, err := s.Out.Write(lines[format])
+		n = written
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return n, firstErr
 }
 
-func (glog *Greenlog) Write(message []byte) (n int, err error) {
-	return glog.print(LevelError, string(message), nil)
+func (gl *Greenlog) Write(message []byte) (n int, err error) {
+	return gl.print(LevelError, string(message), nil)
 }
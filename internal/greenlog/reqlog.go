@@ -1,13 +1,16 @@
 package greenlog
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 )
 
+// Logreq logs a request's method, path and user agent through slog's default
+// logger, which main points at the application's Greenlog.
 func Logreq(r *http.Request, path string) {
-	header := r.Header
-	agent := header.Get("User-Agent")
-	method := r.Method
-	log.Print(agent, " (", method, " ", path, ")")
+	slog.Default().Info("request",
+		slog.String("user_agent", r.Header.Get("User-Agent")),
+		slog.String("method", r.Method),
+		slog.String("path", path),
+	)
 }
@@ -0,0 +1,257 @@
+package greenlog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateOptions says when a RotatingFile starts a new file and what happens
+// to the old ones. Zero values turn each limit off.
+type RotateOptions struct {
+	// MaxSize is the size in bytes a file can grow to before it's rotated.
+	MaxSize int64
+	// Interval is how long a file is written to before it's rotated.
+	Interval time.Duration
+	// MaxBackups is how many rotated files are kept; older ones are deleted.
+	MaxBackups int
+	// Compress gzips rotated files.
+	Compress bool
+}
+
+// backupTimeFormat is the timestamp added to the names of rotated files. It
+// sorts in time order and has no characters which are awkward in file names.
+const backupTimeFormat = "20060102T150405.000000000"
+
+// RotatingFile is an io.Writer which appends to a file, and moves the file
+// aside for a new one when it gets too big or too old. A file at
+// "logs/api.log" is rotated to a name like
+// "logs/api-20261019T150405.000000000.log", which is then gzipped if
+// Compress is set.
+type RotatingFile struct {
+	path   string
+	opts   RotateOptions
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	// wg tracks the goroutines compressing and deleting rotated files, which
+	// take turns with bgMu, and bgErr holds the first error they had, as
+	// there's nowhere to log it.
+	wg    sync.WaitGroup
+	bgMu  sync.Mutex
+	bgErr error
+}
+
+// OpenRotatingFile opens the file at path for appending, creating it and its
+// directory if they don't exist.
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, opts: opts}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would take it over
+// MaxSize or it has been open for longer than Interval. An entry is never
+// split across files, so one bigger than MaxSize gets a file of its own.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	tooBig := f.opts.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.opts.MaxSize
+	tooOld := f.opts.Interval > 0 && time.Since(f.opened) >= f.opts.Interval
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate moves the current file aside and starts a new one, whatever its
+// size and age.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	ext := filepath.Ext(f.path)
+	backup := strings.TrimSuffix(f.path, ext) + "-" + time.Now().Format(backupTimeFormat) + ext
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	// Compressing and deleting old files can take a while, so it happens in
+	// the background rather than holding up the entry being written.
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if err := f.tidyBackups(); err != nil {
+			f.mu.Lock()
+			if f.bgErr == nil {
+				f.bgErr = err
+			}
+			f.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// compressFile gzips the file at path to path+".gz" and removes the
+// original.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// tidyBackups deletes all but the newest MaxBackups rotated files, then
+// compresses those left which haven't been already. It works on every
+// backup rather than the one just rotated, so it doesn't matter which order
+// the goroutines run in, and bgMu keeps two from working at once.
+func (f *RotatingFile) tidyBackups() error {
+	f.bgMu.Lock()
+	defer f.bgMu.Unlock()
+
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	if f.opts.MaxBackups > 0 {
+		for len(backups) > f.opts.MaxBackups {
+			if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			backups = backups[1:]
+		}
+	}
+	if f.opts.Compress {
+		for _, backup := range backups {
+			if strings.HasSuffix(backup, ".gz") {
+				continue
+			}
+			if err := compressFile(backup); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backups returns the paths of the rotated files, oldest first. The
+// timestamps in their names sort in time order.
+func (f *RotatingFile) backups() ([]string, error) {
+	ext := filepath.Ext(f.path)
+	prefix := filepath.Base(strings.TrimSuffix(f.path, ext)) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		stamp = strings.TrimPrefix(stamp, prefix)
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(filepath.Dir(f.path), name))
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Close closes the file, then waits for rotated files to be compressed and
+// deleted. It returns the first error from that background work, if there
+// was one.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.bgErr != nil {
+		return f.bgErr
+	}
+	return err
+}
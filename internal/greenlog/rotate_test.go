@@ -0,0 +1,99 @@
+package greenlog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil || string(current) != "fourth\n" {
+		t.Errorf("got %q, %v in the current file", current, err)
+	}
+
+	// Only the newest two of the three rotated files are kept, gzipped.
+	backups, err := filepath.Glob(filepath.Join(dir, "api-*.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("got backups %v; want 2", backups)
+	}
+	if others, _ := filepath.Glob(filepath.Join(dir, "api-*.log")); len(others) != 0 {
+		t.Errorf("got uncompressed backups %v", others)
+	}
+	var contents []string
+	for _, backup := range backups {
+		contents = append(contents, readGzip(t, backup))
+	}
+	if got := strings.Join(contents, ""); got != "second\nthird\n" {
+		t.Errorf("got %q in the backups", got)
+	}
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+
+	f, err := OpenRotatingFile(path, RotateOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("old\n"))
+	time.Sleep(5 * time.Millisecond)
+	f.Write([]byte("new\n"))
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "api-*.log"))
+	if len(backups) != 1 {
+		t.Fatalf("got backups %v; want 1", backups)
+	}
+	if b, _ := os.ReadFile(backups[0]); string(b) != "old\n" {
+		t.Errorf("got %q in the backup", b)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "new\n" {
+		t.Errorf("got %q in the current file", b)
+	}
+}
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
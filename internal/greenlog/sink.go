@@ -0,0 +1,86 @@
+package greenlog
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Sink is somewhere log entries are written. Each sink has its own minimum
+// level, which entries must reach as well as the logger's, and its own
+// format, so that, say, everything goes to a JSON file while only errors go
+// to the console.
+type Sink struct {
+	Out      io.Writer
+	MinLevel Level
+	Format   Format
+}
+
+// AddSink writes entries to s as well as to the logger's other sinks.
+func (gl *Greenlog) AddSink(s Sink) {
+	gl.core.mu.Lock()
+	defer gl.core.mu.Unlock()
+	gl.core.sinks = append(gl.core.sinks, s)
+}
+
+// Sampling limits how many DEBUG and INFO entries with the same message are
+// written in each Tick: the First are written, then every Thereafter'th
+// after that, or none of them if Thereafter is 0. Entries at WARN and above
+// are always written. It keeps a burst of identical lines, such as one per
+// request during a traffic spike, from drowning out everything else.
+type Sampling struct {
+	Tick       time.Duration
+	First      int
+	Thereafter int
+}
+
+// SetSampling turns on sampling of repetitive entries. A zero Sampling turns
+// it off.
+func (gl *Greenlog) SetSampling(s Sampling) {
+	gl.core.mu.Lock()
+	defer gl.core.mu.Unlock()
+	if s.Tick <= 0 || s.First <= 0 {
+		gl.core.sampler = nil
+		return
+	}
+	gl.core.sampler = &sampler{Sampling: s, counts: make(map[sampleKey]int)}
+}
+
+type sampleKey struct {
+	level   Level
+	message string
+}
+
+// sampler counts the entries with each level and message in the current
+// tick. The counts are thrown away at the start of each tick, so the map
+// only holds the messages seen recently.
+type sampler struct {
+	Sampling
+	mu     sync.Mutex
+	start  time.Time
+	counts map[sampleKey]int
+}
+
+// allow reports whether an entry should be written.
+func (s *sampler) allow(level Level, message string, now time.Time) bool {
+	if level > LevelInfo {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.start) >= s.Tick {
+		s.start = now
+		s.counts = make(map[sampleKey]int)
+	}
+
+	key := sampleKey{level, message}
+	s.counts[key]++
+	n := s.counts[key]
+
+	if n <= s.First {
+		return true
+	}
+	return s.Thereafter > 0 && (n-s.First)%s.Thereafter == 0
+}
@@ -0,0 +1,67 @@
+package greenlog
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSinks(t *testing.T) {
+	var console, file bytes.Buffer
+	logger := New(&console, LevelDebug)
+	logger.SetFormat(FormatConsole)
+	logger.AddSink(Sink{Out: &file, MinLevel: LevelWarn, Format: FormatJSON})
+
+	logger.Debug("details")
+	logger.Warn("careful")
+	logger.Error(errors.New("boom"))
+
+	if got := strings.Count(console.String(), "\n"); got < 3 {
+		t.Errorf("got %d console lines; want every entry:\n%s", got, console.String())
+	}
+	lines := strings.Split(strings.TrimSpace(file.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"message":"careful"`) || !strings.Contains(lines[1], `"message":"boom"`) {
+		t.Errorf("got %q in the JSON sink; want only WARN and above", lines)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelInfo)
+	logger.SetStackLevel(LevelOff)
+	logger.SetSampling(Sampling{Tick: time.Hour, First: 3, Thereafter: 5})
+
+	for i := 0; i < 20; i++ {
+		logger.Info("request")
+		logger.Warn("slow")
+	}
+	logger.Info("other")
+
+	// The first 3 requests, then the 8th, 13th and 18th.
+	if got := strings.Count(buf.String(), `"message":"request"`); got != 6 {
+		t.Errorf("got %d sampled entries; want 6", got)
+	}
+	if got := strings.Count(buf.String(), `"message":"slow"`); got != 20 {
+		t.Errorf("got %d WARN entries; want all 20", got)
+	}
+	if !strings.Contains(buf.String(), `"message":"other"`) {
+		t.Error("a different message was sampled away")
+	}
+
+	// A new tick starts the counts again.
+	s := logger.core.sampler
+	if !s.allow(LevelInfo, "request", time.Now().Add(2*time.Hour)) {
+		t.Error("the first entry of a new tick was dropped")
+	}
+
+	logger.SetSampling(Sampling{})
+	buf.Reset()
+	for i := 0; i < 10; i++ {
+		logger.Info("request")
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 10 {
+		t.Errorf("got %d entries with sampling off; want 10", got)
+	}
+}
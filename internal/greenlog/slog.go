@@ -0,0 +1,116 @@
+package greenlog
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+)
+
+// Handler is a slog.Handler which writes records through a Greenlog, so that
+// code using log/slog, including the standard log package once
+// slog.SetDefault has been called, gets the same entries as everything else.
+type Handler struct {
+	gl *Greenlog
+	// group is the prefix added to the keys of attributes, made from the
+	// names passed to WithGroup, such as "request.".
+	group string
+}
+
+// NewHandler returns a slog.Handler which writes to gl.
+func NewHandler(gl *Greenlog) *Handler {
+	return &Handler{gl: gl}
+}
+
+// Enabled reports whether gl would write entries at level.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.gl.Enabled(fromSlogLevel(level))
+}
+
+// Handle writes r, with its attributes as fields. Attributes in groups get
+// keys like "request.method".
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	fields := make([]Field, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.group, a)
+		return true
+	})
+	_, err := h.gl.print(fromSlogLevel(r.Level), r.Message, fields)
+	return err
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var fields []Field
+	for _, a := range attrs {
+		fields = appendAttr(fields, h.group, a)
+	}
+	return &Handler{gl: h.gl.With(fields...), group: h.group}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &Handler{gl: h.gl, group: h.group + name + "."}
+}
+
+// appendAttr adds a as a field, or the attributes of a group as fields with
+// its name in their keys. Empty attributes are left out, as slog asks.
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		group := a.Value.Group()
+		if len(group) == 0 {
+			return fields
+		}
+		// A group without a name is inlined.
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range group {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: prefix + a.Key, Value: a.Value.Any()})
+}
+
+// fromSlogLevel maps a slog level onto the nearest level at or below it.
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+// StdLogger returns a *log.Logger whose output is written at level, for
+// things such as http.Server.ErrorLog which only take a standard logger.
+func (gl *Greenlog) StdLogger(level Level) *log.Logger {
+	return log.New(levelWriter{gl: gl, level: level}, "", 0)
+}
+
+// levelWriter writes each line it's given as an entry at level.
+type levelWriter struct {
+	gl    *Greenlog
+	level Level
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	// The standard logger ends every line with a newline, which would be
+	// noise in the message.
+	message := string(bytes.TrimRight(p, "\n"))
+	if _, err := w.gl.print(w.level, message, nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
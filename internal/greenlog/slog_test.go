@@ -0,0 +1,103 @@
+package greenlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeEntries parses each line written by a JSON sink.
+func decodeEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("%v in %s", err, line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	gl := New(&buf, LevelInfo)
+	gl.SetStackLevel(LevelOff)
+	logger := slog.New(NewHandler(gl)).With("service", "api")
+
+	logger.Debug("hidden")
+	logger.WithGroup("request").Warn("slow request",
+		slog.String("method", "GET"),
+		slog.Duration("took", 2*time.Second),
+		slog.Group("user", slog.Int64("id", 7)),
+		slog.Group("", slog.Bool("inlined", true)),
+		slog.Any("err", errors.New("timeout")),
+	)
+	logger.Log(context.Background(), slog.LevelError+4, "beyond error")
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries; want 2:\n%s", len(entries), buf.String())
+	}
+
+	if entries[0]["level"] != "WARN" || entries[0]["message"] != "slow request" {
+		t.Errorf("got %v", entries[0])
+	}
+	want := map[string]interface{}{
+		"service":         "api",
+		"request.method":  "GET",
+		"request.took":    "2s",
+		"request.user.id": float64(7),
+		"request.inlined": true,
+		"request.err":     "timeout",
+	}
+	properties, _ := entries[0]["properties"].(map[string]interface{})
+	for key, value := range want {
+		if properties[key] != value {
+			t.Errorf("got %s = %#v; want %#v", key, properties[key], value)
+		}
+	}
+
+	if entries[1]["level"] != "ERROR" {
+		t.Errorf("got level %v for a level above ERROR", entries[1]["level"])
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	gl := New(&buf, LevelInfo)
+
+	gl.StdLogger(LevelWarn).Printf("http: TLS handshake error from %s", "10.0.0.1:1234")
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 1 || entries[0]["level"] != "WARN" ||
+		entries[0]["message"] != "http: TLS handshake error from 10.0.0.1:1234" {
+		t.Errorf("got %v", entries)
+	}
+}
+
+func TestLogreq(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(NewHandler(New(&buf, LevelInfo))))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	r := httptest.NewRequest("GET", "/v1/movies", nil)
+	r.Header.Set("User-Agent", "curl/8.0")
+	Logreq(r, r.URL.Path)
+
+	entries := decodeEntries(t, &buf)
+	properties, _ := entries[0]["properties"].(map[string]interface{})
+	if len(entries) != 1 || properties["method"] != "GET" || properties["path"] != "/v1/movies" ||
+		properties["user_agent"] != "curl/8.0" {
+		t.Errorf("got %v", entries)
+	}
+}
@@ -0,0 +1,120 @@
+// Package i18n translates the messages the API shows to users. Messages are
+// written in English in the code, and each locale has a catalog, in the
+// locales directory, which maps the English text to its translation. A
+// message missing from a catalog is shown in English.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the locale used when the client doesn't ask for one we have.
+const Default = "en"
+
+//go:embed "locales"
+var localeFS embed.FS
+
+// catalogs maps each locale to its catalog. They are embedded in the binary,
+// so a broken catalog is a bug and fails the first test run.
+var catalogs = mustLoadCatalogs()
+
+func mustLoadCatalogs() map[string]map[string]string {
+	files, err := fs.Glob(localeFS, "locales/*.json")
+	if err != nil {
+		panic(err)
+	}
+
+	catalogs := map[string]map[string]string{Default: {}}
+	for _, file := range files {
+		b, err := localeFS.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+
+		var catalog map[string]string
+		if err := json.Unmarshal(b, &catalog); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", file, err))
+		}
+		catalogs[strings.TrimSuffix(path.Base(file), ".json")] = catalog
+	}
+	return catalogs
+}
+
+// Supported returns the locales which have a catalog, in order.
+func Supported() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// IsSupported reports whether there is a catalog for locale.
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Translate returns message in the given locale, or message unchanged if the
+// locale's catalog doesn't have it.
+func Translate(locale, message string) string {
+	if translated, ok := catalogs[locale][message]; ok && translated != "" {
+		return translated
+	}
+	return message
+}
+
+// Match picks the supported locale which best fits an Accept-Language
+// header, such as "fr-CH, fr;q=0.9, en;q=0.8". A region is ignored if there
+// isn't a catalog for it, so "es-MX" matches "es". It returns Default if
+// nothing matches.
+func Match(acceptLanguage string) string {
+	type tag struct {
+		locale string
+		q      float64
+	}
+
+	var tags []tag
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		locale := strings.ToLower(strings.TrimSpace(fields[0]))
+		if locale == "" || locale == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, tag{locale: locale, q: q})
+		}
+	}
+
+	// Tags with the same quality keep the order the client sent them in.
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, t := range tags {
+		if IsSupported(t.locale) {
+			return t.locale
+		}
+		if i := strings.Index(t.locale, "-"); i > 0 && IsSupported(t.locale[:i]) {
+			return t.locale[:i]
+		}
+	}
+	return Default
+}
@@ -0,0 +1,64 @@
+package i18n
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", Default},
+		{"es", "es"},
+		{"ES-mx", "es"},
+		{"de-DE, fr;q=0.8, es;q=0.9", "es"},
+		{"fr;q=0.5, es;q=0.5", "fr"},
+		{"es;q=0, fr;q=0.1", "fr"},
+		{"de, *", Default},
+		{"en-GB, es", "en"},
+		{"garbage;;q=x, fr", "fr"},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.header); got != tt.want {
+			t.Errorf("Match(%q) = %q; want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	if got := Translate("es", "must be provided"); got != "es obligatorio" {
+		t.Errorf("got %q", got)
+	}
+	if got := Translate("es", "not in any catalog"); got != "not in any catalog" {
+		t.Errorf("got %q; want the message unchanged", got)
+	}
+	if got := Translate("xx", "must be provided"); got != "must be provided" {
+		t.Errorf("got %q; want the message unchanged", got)
+	}
+}
+
+// Every catalog should translate the same messages, so that a message added
+// to one and forgotten in another is noticed.
+func TestCatalogsMatch(t *testing.T) {
+	var reference string
+	for _, locale := range Supported() {
+		if locale == Default {
+			continue
+		}
+		if reference == "" {
+			reference = locale
+			continue
+		}
+
+		for msg := range catalogs[reference] {
+			if _, ok := catalogs[locale][msg]; !ok {
+				t.Errorf("%s has no translation of %q", locale, msg)
+			}
+		}
+		for msg := range catalogs[locale] {
+			if _, ok := catalogs[reference][msg]; !ok {
+				t.Errorf("%s has no translation of %q", reference, msg)
+			}
+		}
+	}
+}
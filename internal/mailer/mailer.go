@@ -2,12 +2,18 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
-	"time"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
 
 	"github.com/go-mail/mail/v2"
+	"github.com/jahidhimon/greenlight.git/internal/tracing"
 )
 
 // Below we declare a new variable with the type embed.FS (embedded file system)
@@ -19,73 +25,198 @@ import (
 //go:embed "templates"
 var templateFS embed.FS
 
-// Define mailer struct which contains a mail.Dialer instance
-// (used to connect to a SMTP server) and the sender information
-// for you emails (the name and address you want to the mail to be from)
+// Message is a rendered email, ready to be handed to a Transport.
+type Message struct {
+	To        string
+	From      string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// mailMessage converts the message into a go-mail message, which knows how
+// to encode itself as MIME.
+func (msg *Message) mailMessage() *mail.Message {
+	// SetBody() sets the plain-text body, and AddAlternative() the HTML
+	// body. It's important to note that AddAlternative() should always be
+	// called *after* SetBody.
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+	return m
+}
+
+// Transport delivers messages. SMTPTransport sends them for real; the other
+// transports keep them on the machine, for development and tests.
+type Transport interface {
+	Send(msg *Message) error
+}
 
+// ErrTemplateNotFound is returned when asked for a template which isn't in
+// the templates directory.
+var ErrTemplateNotFound = errors.New("mailer: template not found")
+
+// Define mailer struct which contains the transport used to deliver emails,
+// the sender information for your emails (the name and address you want
+// the mail to be from) and the parsed templates. Templates in the top of the
+// templates directory are keyed by file name, and translations of them, in a
+// subdirectory named after the locale, by locale/file name.
 type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+	transport Transport
+	sender    string
+	templates map[string]*template.Template
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	// Initialize a new mailer dialer instance with the given SMTP settings.
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
+// New parses every template in the templates directory, so that a broken
+// template is found when the application starts rather than when an email
+// is sent.
+func New(transport Transport, sender string) (Mailer, error) {
+	files, err := fs.Glob(templateFS, "templates/*.tmpl")
+	if err != nil {
+		return Mailer{}, err
+	}
+	localized, err := fs.Glob(templateFS, "templates/*/*.tmpl")
+	if err != nil {
+		return Mailer{}, err
+	}
+
+	templates := make(map[string]*template.Template, len(files)+len(localized))
+	for _, file := range append(files, localized...) {
+		tmpl, err := template.New("email").ParseFS(templateFS, file)
+		if err != nil {
+			return Mailer{}, err
+		}
+		for _, name := range []string{"subject", "plainBody", "htmlBody"} {
+			if tmpl.Lookup(name) == nil {
+				return Mailer{}, fmt.Errorf("%s: no %q template defined", file, name)
+			}
+		}
+		templates[strings.TrimPrefix(file, "templates/")] = tmpl
+	}
+
+	// A translation of a template which doesn't exist could never be
+	// sent, so it's most likely misnamed.
+	for _, file := range localized {
+		if _, ok := templates[path.Base(file)]; !ok {
+			return Mailer{}, fmt.Errorf("%s: no templates/%s to translate", file, path.Base(file))
+		}
+	}
 
 	return Mailer{
-		dialer: dialer,
-		sender: sender,
+		transport: transport,
+		sender:    sender,
+		templates: templates,
+	}, nil
+}
+
+// Templates returns the names of the template files, in order.
+func (m Mailer) Templates() []string {
+	var names []string
+	for name := range m.templates {
+		if !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
 	}
+	sort.Strings(names)
+	return names
 }
 
-// Define Send() method on the Mailer type. This takes the recipent email
-// address as the first parameter, the name of the file containing the
-// templates, and any dynamic data for the templates as an interface{}
-// parameter
-func (m Mailer) Send(recipent, templateFile string, data interface{}) error {
-	// Use the parseFS() method to parse the required template file from
-	// the embedded file system.
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
-	if err != nil {
-		return err
+// Locales returns the locales templateFile has been translated into, in
+// order.
+func (m Mailer) Locales(templateFile string) []string {
+	var locales []string
+	for name := range m.templates {
+		if path.Base(name) == templateFile && name != templateFile {
+			locales = append(locales, path.Dir(name))
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// lookup returns the template for templateFile in locale. A locale with a
+// region, like "es-MX", falls back to the language, and a locale without a
+// translation falls back to the untranslated template.
+func (m Mailer) lookup(locale, templateFile string) (*template.Template, bool) {
+	candidates := []string{locale + "/" + templateFile}
+	if i := strings.Index(locale, "-"); i > 0 {
+		candidates = append(candidates, locale[:i]+"/"+templateFile)
+	}
+	candidates = append(candidates, templateFile)
+
+	for _, name := range candidates {
+		if tmpl, ok := m.templates[name]; ok {
+			return tmpl, true
+		}
+	}
+	return nil, false
+}
+
+// Render executes the subject, plainBody and htmlBody templates in
+// templateFile, translated into locale if possible, with data, and returns
+// the result as a message with no recipient or sender.
+func (m Mailer) Render(locale, templateFile string, data interface{}) (*Message, error) {
+	tmpl, ok := m.lookup(locale, templateFile)
+	if !ok {
+		return nil, ErrTemplateNotFound
 	}
 
 	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	err := tmpl.ExecuteTemplate(subject, "subject", data)
 	if err != nil {
-		fmt.Println("fucking plainbody");
-		return err
+		return nil, err
 	}
 
 	plainBody := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
-	if err!= nil {
-		return err
+	if err != nil {
+		return nil, err
 	}
 
 	htmlBody := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Use the mail.NewMessage() function to initialize a new mail.Message instance.
-	// Then we use the SetHeader() method to set email recipent, sender and subject
-	// SetBody() method to set the plain-text-body, and the AddAlternative() method
-	// to set the HTML body. It's important to note that AddAlternative() should
-	// alsways be called *after* SetBody.
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipent)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
-
-	err = m.dialer.DialAndSend(msg)
+	return &Message{
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
+
+// Define Send() method on the Mailer type. This takes the recipent email
+// address as the first parameter, the locale to write the email in, the name
+// of the file containing the templates, and any dynamic data for the
+// templates as an interface{} parameter
+func (m Mailer) Send(recipent, locale, templateFile string, data interface{}) error {
+	return m.SendContext(context.Background(), recipent, locale, templateFile, data)
+}
+
+// SendContext is like Send, but records the send as a span in the trace in
+// ctx, if there is one.
+func (m Mailer) SendContext(ctx context.Context, recipent, locale, templateFile string, data interface{}) error {
+	_, span := tracing.Start(ctx, "mailer.send", tracing.KindClient)
+	defer span.End()
+	span.SetAttributes(
+		tracing.String("mail.template", templateFile),
+		tracing.String("mail.locale", locale),
+		tracing.String("mail.transport", strings.TrimPrefix(fmt.Sprintf("%T", m.transport), "*mailer.")),
+	)
+
+	msg, err := m.Render(locale, templateFile, data)
 	if err != nil {
+		span.RecordError(err)
 		return err
 	}
 
-	return nil
+	msg.To = recipent
+	msg.From = m.sender
+	err = m.transport.Send(msg)
+	span.RecordError(err)
+	return err
 }
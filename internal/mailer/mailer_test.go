@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSend(t *testing.T) {
+	capture := NewCaptureTransport()
+	m, err := New(capture, "Greenlight <no-reply@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("alice@example.com", "en", "user_welcome.tmpl", struct{ ID int64 }{ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := capture.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages; want 1", len(msgs))
+	}
+	msg := msgs[0]
+	if msg.To != "alice@example.com" || msg.From != "Greenlight <no-reply@example.com>" {
+		t.Errorf("got To %q, From %q", msg.To, msg.From)
+	}
+	if msg.Subject != "Welcome to Greenlight!" {
+		t.Errorf("got subject %q", msg.Subject)
+	}
+	if !strings.Contains(msg.PlainBody, "user ID number is 42") || !strings.Contains(msg.HTMLBody, "user ID number is 42") {
+		t.Errorf("bodies don't include the user ID:\n%s\n%s", msg.PlainBody, msg.HTMLBody)
+	}
+
+	sendErr := errors.New("unreachable")
+	capture.SetError(sendErr)
+	if err := m.Send("bob@example.com", "en", "user_welcome.tmpl", struct{ ID int64 }{ID: 43}); !errors.Is(err, sendErr) {
+		t.Errorf("got error %v; want %v", err, sendErr)
+	}
+	if n := len(capture.Messages()); n != 1 {
+		t.Errorf("got %d messages after a failed send; want 1", n)
+	}
+}
+
+func TestRender(t *testing.T) {
+	m, err := New(NewCaptureTransport(), "no-reply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := m.Templates(); len(got) == 0 || got[0] != "user_welcome.tmpl" {
+		t.Errorf("got templates %v; want user_welcome.tmpl first", got)
+	}
+
+	msg, err := m.Render("en", "user_welcome.tmpl", struct{ ID int64 }{ID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.To != "" || msg.From != "" || msg.Subject != "Welcome to Greenlight!" {
+		t.Errorf("got %+v", msg)
+	}
+
+	if got := m.Locales("user_welcome.tmpl"); len(got) == 0 {
+		t.Errorf("got no translations of user_welcome.tmpl")
+	}
+
+	for _, tt := range []struct{ locale, subject string }{
+		{"es", "¡Bienvenido a Greenlight!"},
+		{"es-MX", "¡Bienvenido a Greenlight!"},
+		{"fr", "Bienvenue sur Greenlight !"},
+		{"de", "Welcome to Greenlight!"},
+		{"", "Welcome to Greenlight!"},
+	} {
+		msg, err := m.Render(tt.locale, "user_welcome.tmpl", struct{ ID int64 }{ID: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Subject != tt.subject {
+			t.Errorf("locale %q: got subject %q; want %q", tt.locale, msg.Subject, tt.subject)
+		}
+	}
+
+	if _, err := m.Render("en", "missing.tmpl", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("got error %v; want %v", err, ErrTemplateNotFound)
+	}
+
+	// Data without the fields a template uses is an error, not a message
+	// with holes in it.
+	if _, err := m.Render("en", "user_welcome.tmpl", struct{}{}); err == nil {
+		t.Error("got no error rendering with the wrong data")
+	}
+}
+
+func TestFileTransport(t *testing.T) {
+	dir := t.TempDir()
+	transport, err := NewFileTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(transport, "no-reply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{1, 2} {
+		if err := m.Send("alice@example.com", "en", "user_welcome.tmpl", struct{ ID int64 }{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files in new; want 2", len(files))
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "new", files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: alice@example.com", "Subject: Welcome to Greenlight!", "text/html"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("message doesn't contain %q:\n%s", want, b)
+		}
+	}
+
+	if tmp, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(tmp) != 0 {
+		t.Errorf("got %d files left in tmp; want 0", len(tmp))
+	}
+}
@@ -0,0 +1,143 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+)
+
+// SMTPTransport sends messages through an SMTP server.
+type SMTPTransport struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTPTransport(host string, port int, username, password string) *SMTPTransport {
+	// Initialize a new mailer dialer instance with the given SMTP settings.
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPTransport{dialer: dialer}
+}
+
+func (t *SMTPTransport) Send(msg *Message) error {
+	return t.dialer.DialAndSend(msg.mailMessage())
+}
+
+// FileTransport writes each message to its own file in a maildir, so that
+// it can be read with a mail client such as mutt -f <dir>.
+type FileTransport struct {
+	dir string
+}
+
+// NewFileTransport creates the maildir's tmp, new and cur directories under
+// dir if they don't already exist.
+func NewFileTransport(dir string) (*FileTransport, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0o755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &FileTransport{dir: dir}, nil
+}
+
+func (t *FileTransport) Send(msg *Message) error {
+	name, err := maildirName()
+	if err != nil {
+		return err
+	}
+
+	// Messages are written to tmp and then moved into new, so that a mail
+	// client never sees half a message.
+	tmp := filepath.Join(t.dir, "tmp", name)
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = msg.mailMessage().WriteTo(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(t.dir, "new", name))
+}
+
+// maildirName returns a unique file name for a message, in the time.random
+// form used by maildirs.
+func maildirName() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%s.greenlight", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
+
+// LogTransport writes messages to the log instead of sending them.
+type LogTransport struct {
+	logger *greenlog.Greenlog
+}
+
+func NewLogTransport(logger *greenlog.Greenlog) *LogTransport {
+	return &LogTransport{logger: logger}
+}
+
+func (t *LogTransport) Send(msg *Message) error {
+	t.logger.PrintInfo("email", map[string]string{
+		"to":      msg.To,
+		"from":    msg.From,
+		"subject": msg.Subject,
+		"body":    msg.PlainBody,
+	})
+	return nil
+}
+
+// CaptureTransport keeps every message it is given in memory, so that tests
+// can check what would have been sent.
+type CaptureTransport struct {
+	mu       sync.Mutex
+	messages []Message
+	err      error
+}
+
+func NewCaptureTransport() *CaptureTransport {
+	return &CaptureTransport{}
+}
+
+func (t *CaptureTransport) Send(msg *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return t.err
+	}
+	t.messages = append(t.messages, *msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (t *CaptureTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Message(nil), t.messages...)
+}
+
+// SetError makes every later Send fail with err, or succeed again if err is
+// nil.
+func (t *CaptureTransport) SetError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
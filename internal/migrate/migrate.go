@@ -0,0 +1,342 @@
+// Package migrate applies the SQL migrations in an fs.FS to a PostgreSQL
+// database. The current version is recorded in a schema_migrations table with
+// the same layout golang-migrate uses, so databases which were migrated with
+// that tool can be taken over without any changes.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jahidhimon/greenlight.git/internal/greenlog"
+)
+
+// lockID is the key for the PostgreSQL advisory lock held while migrations
+// run, so that several instances starting at once don't race each other.
+const lockID = 7_243_518_906
+
+var (
+	ErrDirty           = errors.New("database is in a dirty state")
+	ErrUnknownVersion  = errors.New("unknown migration version")
+	ErrMissingDownFile = errors.New("migration has no down file")
+)
+
+var fileRX = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a single pair of up and down SQL scripts.
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+	hasDown bool
+}
+
+// Status describes the state of the database and of every known migration.
+type Status struct {
+	// Version is the version of the last applied migration, or 0 if none
+	// have been applied.
+	Version    int64
+	Dirty      bool
+	Migrations []MigrationStatus
+}
+
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	Applied bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	logger     *greenlog.Greenlog
+	migrations []Migration
+}
+
+// New reads the migrations from the top level of fsys. The logger may be nil.
+func New(db *sql.DB, fsys fs.FS, logger *greenlog.Greenlog) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	// files maps a version and direction, like "3.up", to its file name, so
+	// that 3_x.up.sql and 003_x.up.sql aren't both used.
+	files := make(map[string]string)
+	for _, entry := range entries {
+		matches := fileRX.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+
+		key := fmt.Sprintf("%d.%s", version, matches[3])
+		if other, ok := files[key]; ok {
+			return nil, fmt.Errorf("migration %d has two %s files: %s and %s", version, matches[3], other, entry.Name())
+		}
+		files[key] = entry.Name()
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has files with different names", version)
+		}
+
+		switch matches[3] {
+		case "up":
+			m.up = string(content)
+		case "down":
+			m.down = string(content)
+			m.hasDown = true
+		}
+	}
+
+	migrator := &Migrator{db: db, logger: logger}
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", m.Version)
+		}
+		migrator.migrations = append(migrator.migrations, *m)
+	}
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+// Up applies every pending migration and returns how many were applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	if len(m.migrations) == 0 {
+		return 0, nil
+	}
+	return m.migrateTo(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down rolls back the given number of migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	var applied int
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		i := m.index(current)
+		if current != 0 && i == -1 {
+			return fmt.Errorf("%w: database is at %d", ErrUnknownVersion, current)
+		}
+		target := int64(0)
+		if i-steps >= 0 {
+			target = m.migrations[i-steps].Version
+		}
+		applied, err = m.migrate(ctx, conn, current, target)
+		return err
+	})
+	return applied, err
+}
+
+// Goto migrates up or down to the given version. Version 0 rolls back every
+// migration.
+func (m *Migrator) Goto(ctx context.Context, version int64) (int, error) {
+	if version != 0 && m.index(version) == -1 {
+		return 0, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return m.migrateTo(ctx, version)
+}
+
+// Status reports the current version and which migrations have been applied.
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		var err error
+		status.Version, status.Dirty, err = m.readVersion(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return Status{}, err
+	}
+
+	for _, migration := range m.migrations {
+		status.Migrations = append(status.Migrations, MigrationStatus{
+			Version: migration.Version,
+			Name:    migration.Name,
+			Applied: migration.Version <= status.Version,
+		})
+	}
+	return status, nil
+}
+
+func (m *Migrator) migrateTo(ctx context.Context, target int64) (int, error) {
+	var applied int
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		applied, err = m.migrate(ctx, conn, current, target)
+		return err
+	})
+	return applied, err
+}
+
+// migrate runs the up or down scripts needed to get from current to target.
+// Each migration runs in its own transaction together with the update of
+// schema_migrations, so a failure leaves the database at the last good
+// version rather than dirty.
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, current, target int64) (int, error) {
+	applied := 0
+
+	if target >= current {
+		for _, migration := range m.migrations {
+			if migration.Version <= current || migration.Version > target {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration.up, migration.Version); err != nil {
+				return applied, fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			m.log("applied migration", migration, "up")
+			applied++
+		}
+		return applied, nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current || migration.Version <= target {
+			continue
+		}
+		if !migration.hasDown {
+			return applied, fmt.Errorf("%w: %d_%s", ErrMissingDownFile, migration.Version, migration.Name)
+		}
+
+		previous := int64(0)
+		if i > 0 {
+			previous = m.migrations[i-1].Version
+		}
+		if err := m.apply(ctx, conn, migration.down, previous); err != nil {
+			return applied, fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+		m.log("rolled back migration", migration, "down")
+		applied++
+	}
+	return applied, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, version int64) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version > 0 {
+		query := `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`
+		if _, err := tx.ExecContext(ctx, query, version); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// currentVersion returns the current version, refusing to go on if a previous
+// run left the database dirty.
+func (m *Migrator) currentVersion(ctx context.Context, conn *sql.Conn) (int64, error) {
+	version, dirty, err := m.readVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w at version %d, fix it by hand before migrating", ErrDirty, version)
+	}
+	return version, nil
+}
+
+func (m *Migrator) readVersion(ctx context.Context, conn *sql.Conn) (int64, bool, error) {
+	var version int64
+	var dirty bool
+	err := conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).
+		Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+	return version, dirty, nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory
+// lock. Advisory locks belong to the session, so everything has to happen on
+// the same connection.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	query := `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version bigint NOT NULL PRIMARY KEY,
+	dirty boolean NOT NULL
+)`
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// index returns the position of version in m.migrations, or -1.
+func (m *Migrator) index(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Migrator) log(message string, migration Migration, direction string) {
+	if m.logger == nil {
+		return
+	}
+	m.logger.PrintInfo(message, map[string]string{
+		"version":   strconv.FormatInt(migration.Version, 10),
+		"name":      migration.Name,
+		"direction": direction,
+	})
+}
@@ -0,0 +1,363 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// fakeDB is the state of a database behind the fake driver. It understands
+// the handful of statements the Migrator makes about schema_migrations, and
+// records every other statement as a migration script. A script containing
+// FAIL returns an error.
+type fakeDB struct {
+	mu       sync.Mutex
+	version  int64
+	dirty    bool
+	hasRow   bool
+	executed []string
+}
+
+type fakeDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDB
+}
+
+var testDriver = &fakeDriver{dbs: make(map[string]*fakeDB)}
+
+func init() {
+	sql.Register("fakemigrate", testDriver)
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &fakeConn{db: d.dbs[name]}, nil
+}
+
+// openFakeDB returns a *sql.DB connected to a new, empty fake database.
+func openFakeDB(t *testing.T) (*sql.DB, *fakeDB) {
+	t.Helper()
+
+	state := &fakeDB{}
+	testDriver.mu.Lock()
+	testDriver.dbs[t.Name()] = state
+	testDriver.mu.Unlock()
+
+	db, err := sql.Open("fakemigrate", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, state
+}
+
+type fakeConn struct {
+	db *fakeDB
+	// saved holds the database as it was when a transaction began, so that
+	// Rollback can put it back.
+	saved *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake driver: Prepare not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.saved = &fakeDB{
+		version:  c.db.version,
+		dirty:    c.db.dirty,
+		hasRow:   c.db.hasRow,
+		executed: append([]string(nil), c.db.executed...),
+	}
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.saved = nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	if c.saved == nil {
+		return nil
+	}
+
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.db.version, c.db.dirty, c.db.hasRow = c.saved.version, c.saved.dirty, c.saved.hasRow
+	c.db.executed = c.saved.executed
+	c.saved = nil
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "pg_advisory"),
+		strings.Contains(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+		c.db.hasRow = false
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		c.db.version, c.db.dirty, c.db.hasRow = args[0].Value.(int64), false, true
+	case strings.Contains(query, "FAIL"):
+		return nil, errors.New("syntax error")
+	default:
+		c.db.executed = append(c.db.executed, query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	if !strings.HasPrefix(query, "SELECT version, dirty FROM schema_migrations") {
+		return nil, errors.New("fake driver: unexpected query " + query)
+	}
+	rows := &fakeRows{}
+	if c.db.hasRow {
+		rows.values = [][]driver.Value{{c.db.version, c.db.dirty}}
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version", "dirty"} }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func formatMigration(m Migration) string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+func file(content string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(content)}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []string // version_name of each migration, in order
+		wantErr bool
+	}{
+		{
+			name: "up and down files",
+			fsys: fstest.MapFS{
+				"000001_create_movies.up.sql":   file("CREATE TABLE movies"),
+				"000001_create_movies.down.sql": file("DROP TABLE movies"),
+				"000002_add_index.up.sql":       file("CREATE INDEX"),
+				"README.md":                     file("not a migration"),
+				"000003_no_direction.sql":       file("not a migration"),
+				"old/000004_nested.up.sql":      file("not at the top level"),
+			},
+			want: []string{"1_create_movies", "2_add_index"},
+		},
+		{
+			name: "ordered by version number",
+			fsys: fstest.MapFS{
+				"10_c.up.sql": file("c"),
+				"2_b.up.sql":  file("b"),
+				"1_a.up.sql":  file("a"),
+			},
+			want: []string{"1_a", "2_b", "10_c"},
+		},
+		{
+			name:    "missing up file",
+			fsys:    fstest.MapFS{"000001_a.down.sql": file("DROP TABLE a")},
+			wantErr: true,
+		},
+		{
+			name: "mismatched names",
+			fsys: fstest.MapFS{
+				"000001_a.up.sql":   file("CREATE TABLE a"),
+				"000001_b.down.sql": file("DROP TABLE b"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate version",
+			fsys: fstest.MapFS{
+				"1_a.up.sql":   file("CREATE TABLE a"),
+				"001_a.up.sql": file("CREATE TABLE a2"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(nil, tt.fsys, nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got nil error; want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m.migrations) != len(tt.want) {
+				t.Fatalf("got %d migrations; want %v", len(m.migrations), tt.want)
+			}
+			for i, migration := range m.migrations {
+				if want := tt.want[i]; formatMigration(migration) != want {
+					t.Errorf("migration %d is %s; want %s", i, formatMigration(migration), want)
+				}
+			}
+		})
+	}
+}
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"000001_a.up.sql":   file("up 1"),
+		"000001_a.down.sql": file("down 1"),
+		"000002_b.up.sql":   file("up 2"),
+		"000002_b.down.sql": file("down 2"),
+		"000003_c.up.sql":   file("up 3"),
+		"000003_c.down.sql": file("down 3"),
+	}
+}
+
+func TestMigratorStatusAndGoto(t *testing.T) {
+	ctx := context.Background()
+	db, state := openFakeDB(t)
+
+	m, err := New(db, testMigrations(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != 0 || len(status.Migrations) != 3 || status.Migrations[0].Applied {
+		t.Fatalf("got %+v; want version 0 with 3 pending migrations", status)
+	}
+
+	if n, err := m.Goto(ctx, 2); err != nil || n != 2 {
+		t.Fatalf("Goto(2) = %d, %v; want 2, nil", n, err)
+	}
+	status, err = m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := []bool{true, true, false}
+	for i, ms := range status.Migrations {
+		if ms.Applied != applied[i] {
+			t.Errorf("migration %d: got applied %v; want %v", ms.Version, ms.Applied, applied[i])
+		}
+	}
+	if status.Version != 2 {
+		t.Errorf("got version %d; want 2", status.Version)
+	}
+
+	if n, err := m.Up(ctx); err != nil || n != 1 {
+		t.Fatalf("Up() = %d, %v; want 1, nil", n, err)
+	}
+	if n, err := m.Goto(ctx, 1); err != nil || n != 2 {
+		t.Fatalf("Goto(1) = %d, %v; want 2, nil", n, err)
+	}
+	if n, err := m.Down(ctx, 1); err != nil || n != 1 {
+		t.Fatalf("Down(1) = %d, %v; want 1, nil", n, err)
+	}
+
+	want := []string{"up 1", "up 2", "up 3", "down 3", "down 2", "down 1"}
+	if strings.Join(state.executed, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got scripts %v; want %v", state.executed, want)
+	}
+	if state.hasRow {
+		t.Errorf("got version %d recorded; want none", state.version)
+	}
+
+	if _, err := m.Goto(ctx, 7); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Goto(7): got error %v; want %v", err, ErrUnknownVersion)
+	}
+}
+
+func TestMigratorErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("failed migration", func(t *testing.T) {
+		db, state := openFakeDB(t)
+		fsys := testMigrations()
+		fsys["000002_b.up.sql"] = file("FAIL")
+
+		m, err := New(db, fsys, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := m.Up(ctx); err == nil || n != 1 {
+			t.Fatalf("Up() = %d, %v; want 1 and an error", n, err)
+		}
+		// The database is left at the last migration which worked.
+		if state.version != 1 || state.dirty {
+			t.Errorf("got version %d, dirty %v; want 1, false", state.version, state.dirty)
+		}
+	})
+
+	t.Run("missing down file", func(t *testing.T) {
+		db, _ := openFakeDB(t)
+		fsys := testMigrations()
+		delete(fsys, "000003_c.down.sql")
+
+		m, err := New(db, fsys, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Down(ctx, 1); !errors.Is(err, ErrMissingDownFile) {
+			t.Errorf("got error %v; want %v", err, ErrMissingDownFile)
+		}
+	})
+
+	t.Run("dirty database", func(t *testing.T) {
+		db, state := openFakeDB(t)
+		state.version, state.dirty, state.hasRow = 2, true, true
+
+		m, err := New(db, testMigrations(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Up(ctx); !errors.Is(err, ErrDirty) {
+			t.Errorf("got error %v; want %v", err, ErrDirty)
+		}
+		status, err := m.Status(ctx)
+		if err != nil || !status.Dirty || status.Version != 2 {
+			t.Errorf("got %+v, %v; want dirty at version 2", status, err)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// SpanData is a finished span, as it's given to an exporter. The field names
+// follow OpenTelemetry's, so that exported spans are easy to load into other
+// tools.
+type SpanData struct {
+	TraceID       string                 `json:"trace_id"`
+	SpanID        string                 `json:"span_id"`
+	ParentSpanID  string                 `json:"parent_span_id,omitempty"`
+	Name          string                 `json:"name"`
+	Kind          Kind                   `json:"kind"`
+	Service       string                 `json:"service,omitempty"`
+	Start         time.Time              `json:"start_time"`
+	End           time.Time              `json:"end_time"`
+	Duration      float64                `json:"duration_ms"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Status        string                 `json:"status"`
+	StatusMessage string                 `json:"status_message,omitempty"`
+}
+
+// Exporter sends finished spans somewhere: a file, a collector, or a test's
+// memory. Export is called as each span ends, from whichever goroutine ends
+// it.
+type Exporter interface {
+	Export(span SpanData) error
+}
+
+// WriterExporter writes each span as a line of JSON, to stdout or a file for
+// example, so traces can be looked at without running a collector.
+type WriterExporter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewWriterExporter(out io.Writer) *WriterExporter {
+	return &WriterExporter{out: out}
+}
+
+func (e *WriterExporter) Export(span SpanData) error {
+	line, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err = e.out.Write(append(line, '\n'))
+	return err
+}
+
+// MemoryExporter keeps spans in memory, for tests.
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *MemoryExporter) Export(span SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (e *MemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
@@ -0,0 +1,361 @@
+// Package tracing records spans, the timed steps of a piece of work such as
+// an HTTP request and the queries it makes, and writes them to an exporter.
+// Spans use the same IDs and the same traceparent header as the W3C Trace
+// Context spec and OpenTelemetry, so a trace can start or carry on in other
+// services, but the package has no dependencies of its own.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceID identifies a trace: every span in it has the same TraceID.
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid reports whether t isn't all zeros, which the spec reserves.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is what a span passes on to its children, in this process or
+// another one: which trace it's in, its own ID, and whether the trace is
+// being recorded.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent returns sc in the format of the traceparent header, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+var errInvalidTraceparent = errors.New("tracing: invalid traceparent")
+
+// ParseTraceparent reads a traceparent header. Versions after 00 are read as
+// far as the fields version 00 has, as the spec asks.
+func ParseTraceparent(header string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errInvalidTraceparent
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, errInvalidTraceparent
+	}
+	for _, p := range parts[:4] {
+		if strings.ToLower(p) != p {
+			return sc, errInvalidTraceparent
+		}
+	}
+
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if !sc.IsValid() {
+		return sc, errInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// Kind says what part a span plays in a trace.
+type Kind string
+
+const (
+	KindInternal Kind = "internal"
+	// KindServer is a span for handling a request from a client.
+	KindServer Kind = "server"
+	// KindClient is a span for a request to another service, such as a
+	// database query.
+	KindClient Kind = "client"
+	// KindConsumer is a span for handling a queued message, such as a job.
+	KindConsumer Kind = "consumer"
+)
+
+// Attr is a key and value recorded on a span.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attr          { return Attr{key, value} }
+func Int(key string, value int) Attr         { return Attr{key, value} }
+func Int64(key string, value int64) Attr     { return Attr{key, value} }
+func Bool(key string, value bool) Attr       { return Attr{key, value} }
+func Float64(key string, value float64) Attr { return Attr{key, value} }
+
+// Tracer starts spans and sends them to an exporter when they end.
+type Tracer struct {
+	exporter    Exporter
+	service     string
+	sampleRatio float64
+	onError     func(error)
+}
+
+// New returns a tracer which sends spans to exporter, tagged with the name
+// of the service. Traces started here are recorded with the probability
+// sampleRatio, from 0 to 1; traces which come from elsewhere are recorded if
+// their traceparent says they are.
+func New(exporter Exporter, service string, sampleRatio float64) *Tracer {
+	return &Tracer{exporter: exporter, service: service, sampleRatio: sampleRatio}
+}
+
+// OnExportError sets a function which is called with the error when a span
+// can't be exported, as the code ending the span has no way to handle it.
+func (t *Tracer) OnExportError(fn func(error)) {
+	t.onError = fn
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetDefault makes t the tracer used by Start. With no default tracer, Start
+// doesn't record anything.
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start starts a span with the default tracer. See Tracer.Start.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	return defaultTracer.Load().Start(ctx, name, kind)
+}
+
+// Start starts a span, which is a child of the span in ctx or of a remote
+// parent added with ContextWithRemoteSpanContext, or else the root of a new
+// trace. It returns a copy of ctx carrying the span, for its children to
+// start from.
+//
+// A nil tracer returns ctx and a nil span, whose methods do nothing, so that
+// code can be traced without checking whether tracing is on.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	s.sc.SpanID = newSpanID()
+
+	if parent := SpanContextFromContext(ctx); parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		s.sc.TraceID = newTraceID()
+		s.sc.Sampled = t.sample(s.sc.TraceID)
+	}
+	return ContextWithSpan(ctx, s), s
+}
+
+// sample decides whether to record a new trace. It goes by the trace ID, as
+// OpenTelemetry's ratio sampler does, so the decision for a trace is the
+// same wherever it's made.
+func (t *Tracer) sample(id TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	bound := uint64(t.sampleRatio * (1 << 63))
+	return binary.BigEndian.Uint64(id[8:])>>1 < bound
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		mustRead(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		mustRead(id[:])
+	}
+	return id
+}
+
+func mustRead(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("tracing: can't generate an ID: %v", err))
+	}
+}
+
+// Span is a timed step in a trace. Its methods are safe to call from several
+// goroutines, and on a nil span, which is what Start returns when tracing is
+// off.
+type Span struct {
+	tracer *Tracer
+	name   string
+	kind   Kind
+	sc     SpanContext
+	parent SpanID
+	start  time.Time
+
+	mu     sync.Mutex
+	attrs  []Attr
+	errMsg string
+	failed bool
+	ended  bool
+}
+
+// SpanContext returns the IDs of s, or a zero SpanContext for a nil span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes records attrs on the span. A key which is set again keeps
+// its last value.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// SetName changes the span's name, for when it's only known once the work
+// has started.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// RecordError marks the span as failed with err. A nil err does nothing.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.errMsg = err.Error()
+}
+
+// End finishes the span and exports it if its trace is being recorded. Calls
+// after the first do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := s.data(end)
+	s.mu.Unlock()
+
+	if !s.sc.Sampled {
+		return
+	}
+	if err := s.tracer.exporter.Export(data); err != nil && s.tracer.onError != nil {
+		s.tracer.onError(err)
+	}
+}
+
+// data returns the finished span for an exporter. s.mu must be held.
+func (s *Span) data(end time.Time) SpanData {
+	d := SpanData{
+		TraceID:  s.sc.TraceID.String(),
+		SpanID:   s.sc.SpanID.String(),
+		Name:     s.name,
+		Kind:     s.kind,
+		Service:  s.tracer.service,
+		Start:    s.start,
+		End:      end,
+		Duration: float64(end.Sub(s.start)) / float64(time.Millisecond),
+		Status:   "ok",
+	}
+	if s.parent.IsValid() {
+		d.ParentSpanID = s.parent.String()
+	}
+	if s.failed {
+		d.Status = "error"
+		d.StatusMessage = s.errMsg
+	}
+	if len(s.attrs) > 0 {
+		d.Attributes = make(map[string]interface{}, len(s.attrs))
+		for _, a := range s.attrs {
+			d.Attributes[a.Key] = a.Value
+		}
+	}
+	return d
+}
+
+type spanContextKey struct{}
+type remoteContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying s.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+// SpanFromContext returns the span in ctx, or nil if there isn't one.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx carrying a parent from
+// another process, such as one read from a traceparent header, for the next
+// span started from it.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the IDs of the span in ctx, or of the remote
+// parent in ctx if there's no span, or a zero SpanContext if there's neither.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteContextKey{}).(SpanContext)
+	return sc
+}
@@ -0,0 +1,153 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceparent(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("got %+v", sc)
+	}
+	if got := sc.Traceparent(); got != valid {
+		t.Errorf("got %q back; want %q", got, valid)
+	}
+
+	// Later versions may add fields, which are ignored.
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Errorf("got %v for a later version", err)
+	}
+
+	invalid := []string{
+		"",
+		"garbage",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	}
+	for _, header := range invalid {
+		if _, err := ParseTraceparent(header); err == nil {
+			t.Errorf("ParseTraceparent(%q) didn't fail", header)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	exporter := &MemoryExporter{}
+	tracer := New(exporter, "test", 1)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ContextWithRemoteSpanContext(context.Background(), remote)
+
+	ctx, root := tracer.Start(ctx, "request", KindServer)
+	_, child := tracer.Start(ctx, "query", KindClient)
+	child.SetAttributes(String("db.system", "postgresql"), Int("rows", 1), Int("rows", 2))
+	child.RecordError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans; want 2", len(spans))
+	}
+	query, request := spans[0], spans[1]
+	if request.TraceID != remote.TraceID.String() || request.ParentSpanID != remote.SpanID.String() {
+		t.Errorf("the request span doesn't carry on the remote trace: %+v", request)
+	}
+	if query.TraceID != request.TraceID || query.ParentSpanID != request.SpanID {
+		t.Errorf("the query span isn't a child of the request span: %+v", query)
+	}
+	if query.Status != "error" || query.StatusMessage != "boom" || query.Attributes["rows"] != 2 {
+		t.Errorf("got %+v", query)
+	}
+	if request.Status != "ok" || request.Service != "test" || request.Kind != KindServer {
+		t.Errorf("got %+v", request)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	exporter := &MemoryExporter{}
+	tracer := New(exporter, "test", 0)
+
+	ctx, root := tracer.Start(context.Background(), "request", KindServer)
+	_, child := tracer.Start(ctx, "query", KindClient)
+	child.End()
+	root.End()
+
+	// Unrecorded spans still have IDs to pass on.
+	if !root.SpanContext().IsValid() || root.SpanContext().Sampled {
+		t.Errorf("got %+v", root.SpanContext())
+	}
+	if child.SpanContext().TraceID != root.SpanContext().TraceID {
+		t.Error("the child of an unrecorded span started a new trace")
+	}
+	if spans := exporter.Spans(); len(spans) != 0 {
+		t.Errorf("got %d spans from an unrecorded trace", len(spans))
+	}
+
+	// A sampled parent from elsewhere wins over the ratio.
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, span := tracer.Start(ContextWithRemoteSpanContext(context.Background(), remote), "request", KindServer)
+	span.End()
+	if spans := exporter.Spans(); len(spans) != 1 {
+		t.Errorf("got %d spans; want the one with a sampled parent", len(spans))
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+
+	ctx := context.Background()
+	got, span := tracer.Start(ctx, "request", KindServer)
+	if got != ctx || span != nil {
+		t.Fatal("a nil tracer started a span")
+	}
+
+	// A nil span's methods do nothing.
+	span.SetAttributes(String("a", "b"))
+	span.SetName("other")
+	span.RecordError(errors.New("boom"))
+	span.End()
+	if span.SpanContext().IsValid() {
+		t.Error("a nil span has a valid span context")
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := New(NewWriterExporter(&buf), "greenlight", 1)
+
+	_, span := tracer.Start(context.Background(), "job welcome_email", KindConsumer)
+	span.SetAttributes(Int64("job.id", 7))
+	span.End()
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%v in %s", err, buf.String())
+	}
+	for _, key := range []string{"trace_id", "span_id", "start_time", "end_time", "duration_ms"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("no %s in %s", key, buf.String())
+		}
+	}
+	if got["name"] != "job welcome_email" || got["kind"] != "consumer" || got["service"] != "greenlight" {
+		t.Errorf("got %s", buf.String())
+	}
+	if _, ok := got["parent_span_id"]; ok {
+		t.Errorf("a root span has a parent: %s", buf.String())
+	}
+}
@@ -0,0 +1,210 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RuleFunc reports whether value passes a rule. param is the text after the
+// '=' in the tag, such as "5" in "max=5", or "" if there isn't one.
+type RuleFunc func(value reflect.Value, param string) bool
+
+// rule is a named check which can be used in validate tags. message returns
+// the error message for a value which fails it.
+type rule struct {
+	code    string
+	check   RuleFunc
+	message func(value reflect.Value, param string) string
+}
+
+var (
+	registryMu sync.RWMutex
+	rules      = map[string]rule{}
+	patterns   = map[string]*regexp.Regexp{}
+)
+
+// RegisterRule adds a rule which can be used in validate tags by name, such
+// as `validate:"required,locale"`. A field which fails it gets an error with
+// the given code and message; "%s" in the message is replaced with the
+// rule's param. Registering a name twice replaces the earlier rule, so
+// built-in rules can be overridden.
+func RegisterRule(name, code, message string, check RuleFunc) {
+	registerRule(name, rule{
+		code:  code,
+		check: check,
+		message: func(_ reflect.Value, param string) string {
+			if strings.Contains(message, "%s") {
+				return fmt.Sprintf(message, param)
+			}
+			return message
+		},
+	})
+}
+
+func registerRule(name string, r rule) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	rules[name] = r
+}
+
+func lookupRule(name string) (rule, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := rules[name]
+	return r, ok
+}
+
+// RegisterPattern names a regular expression for the regex rule, so that
+// `validate:"regex=slug"` checks a string against the pattern named slug.
+// Patterns are registered by name because a tag can't hold a regular
+// expression containing a comma.
+func RegisterPattern(name string, rx *regexp.Regexp) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	patterns[name] = rx
+}
+
+func lookupPattern(name string) *regexp.Regexp {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	rx, ok := patterns[name]
+	if !ok {
+		panic(fmt.Sprintf("validator: no pattern registered as %q", name))
+	}
+	return rx
+}
+
+func init() {
+	registerRule("min", rule{
+		code: "min",
+		check: func(value reflect.Value, param string) bool {
+			return measure(value) >= number(param)
+		},
+		message: func(value reflect.Value, param string) string {
+			switch value.Kind() {
+			case reflect.String:
+				return "must be at least " + param + " bytes long"
+			case reflect.Slice, reflect.Array, reflect.Map:
+				return "must contain at least " + items(param)
+			default:
+				return "must be at least " + param
+			}
+		},
+	})
+
+	registerRule("max", rule{
+		code: "max",
+		check: func(value reflect.Value, param string) bool {
+			return measure(value) <= number(param)
+		},
+		message: func(value reflect.Value, param string) string {
+			switch value.Kind() {
+			case reflect.String:
+				return "must not be more than " + param + " bytes long"
+			case reflect.Slice, reflect.Array, reflect.Map:
+				return "must not contain more than " + items(param)
+			default:
+				return "must not be more than " + param
+			}
+		},
+	})
+
+	registerRule("len", rule{
+		code: "len",
+		check: func(value reflect.Value, param string) bool {
+			return measure(value) == number(param)
+		},
+		message: func(value reflect.Value, param string) string {
+			switch value.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				return "must contain exactly " + items(param)
+			default:
+				return "must be " + param + " bytes long"
+			}
+		},
+	})
+
+	registerRule("unique", rule{
+		code: "unique",
+		check: func(value reflect.Value, _ string) bool {
+			seen := make(map[interface{}]bool, value.Len())
+			for i := 0; i < value.Len(); i++ {
+				elem := value.Index(i).Interface()
+				if seen[elem] {
+					return false
+				}
+				seen[elem] = true
+			}
+			return true
+		},
+		message: func(reflect.Value, string) string {
+			return "must not contain duplicates"
+		},
+	})
+
+	registerRule("oneof", rule{
+		code: "oneof",
+		check: func(value reflect.Value, param string) bool {
+			return In(fmt.Sprint(value.Interface()), strings.Fields(param)...)
+		},
+		message: func(_ reflect.Value, param string) string {
+			return "must be one of " + strings.Join(strings.Fields(param), ", ")
+		},
+	})
+
+	registerRule("email", rule{
+		code: "email",
+		check: func(value reflect.Value, _ string) bool {
+			return Matches(value.String(), EmailRX)
+		},
+		message: func(reflect.Value, string) string {
+			return "must be a valid email address"
+		},
+	})
+
+	registerRule("regex", rule{
+		code: "regex",
+		check: func(value reflect.Value, param string) bool {
+			return Matches(value.String(), lookupPattern(param))
+		},
+		message: func(reflect.Value, string) string {
+			return "must be in a valid format"
+		},
+	})
+}
+
+// measure returns the length of a string, slice, array or map, or the value
+// of a number, for comparing against the param of min, max and len.
+func measure(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	}
+	panic(fmt.Sprintf("validator: can't measure a %s", value.Type()))
+}
+
+func number(param string) float64 {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validator: %q isn't a number", param))
+	}
+	return n
+}
+
+// items returns "1 item" or "n items".
+func items(n string) string {
+	if n == "1" {
+		return "1 item"
+	}
+	return n + " items"
+}
@@ -0,0 +1,155 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Struct checks the fields of the struct s, or the struct s points to,
+// against the rules in their validate tags, and adds an error for each rule a
+// field breaks. Rules are separated by commas:
+//
+//	Genres []string `json:"genres" validate:"required,max=5,unique,dive,required"`
+//
+// The built-in rules are required, min, max, len, unique, oneof, email and
+// regex; RegisterRule adds more. A field which isn't required is only checked
+// if it has a value. Rules after "dive" are applied to each element of a
+// slice, under keys like "genres[2]".
+//
+// Errors are keyed by the field's JSON name, or by its key tag if it has one.
+// Nested structs, and slices of structs, are checked too, with keys like
+// "cast[0].name".
+func (v *Validator) Struct(s interface{}) {
+	value := reflect.Indirect(reflect.ValueOf(s))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validator: Struct needs a struct, not %s", value.Type()))
+	}
+	v.structFields("", value)
+}
+
+// Var checks a single value against rules written as in a validate tag, and
+// adds an error under key for each rule it breaks.
+func (v *Validator) Var(key string, value interface{}, tag string) {
+	v.field(key, reflect.ValueOf(value), tag)
+}
+
+func (v *Validator) structFields(prefix string, value reflect.Value) {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		key := prefix + fieldKey(f)
+		tag := f.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		if tag != "" {
+			v.field(key, value.Field(i), tag)
+		}
+		v.nested(key, value.Field(i))
+	}
+}
+
+// nested checks the fields of a struct, or of each struct in a slice.
+func (v *Validator) nested(key string, value reflect.Value) {
+	value = reflect.Indirect(value)
+
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() != reflect.TypeOf(time.Time{}) {
+			v.structFields(key+".", value)
+		}
+	case reflect.Slice, reflect.Array:
+		elem := value.Type().Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct || elem == reflect.TypeOf(time.Time{}) {
+			return
+		}
+		for i := 0; i < value.Len(); i++ {
+			if e := reflect.Indirect(value.Index(i)); e.IsValid() {
+				v.structFields(fmt.Sprintf("%s[%d].", key, i), e)
+			}
+		}
+	}
+}
+
+// field checks one value against the rules in tag.
+func (v *Validator) field(key string, value reflect.Value, tag string) {
+	names := strings.Split(tag, ",")
+
+	dive := len(names)
+	for i, name := range names {
+		if name == "dive" {
+			dive = i
+			break
+		}
+	}
+	own := names[:dive]
+
+	// A nil pointer is treated as a missing value; otherwise rules see
+	// what it points to.
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value = reflect.Value{}
+		} else {
+			value = value.Elem()
+		}
+	}
+
+	if !value.IsValid() || value.IsZero() {
+		if In("required", own...) {
+			v.AddErrorCode(key, "required", "must be provided")
+		}
+		return
+	}
+
+	for _, name := range own {
+		if name == "required" || name == "" {
+			continue
+		}
+
+		param := ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, param = name[:i], name[i+1:]
+		}
+
+		r, ok := lookupRule(name)
+		if !ok {
+			panic(fmt.Sprintf("validator: unknown rule %q", name))
+		}
+		if !r.check(value, param) {
+			v.AddErrorCode(key, r.code, r.message(value, param))
+		}
+	}
+
+	if dive < len(names) {
+		if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+			panic(fmt.Sprintf("validator: can't dive into %s", value.Type()))
+		}
+		elemTag := strings.Join(names[dive+1:], ",")
+		for i := 0; i < value.Len(); i++ {
+			v.field(fmt.Sprintf("%s[%d]", key, i), value.Index(i), elemTag)
+		}
+	}
+}
+
+// fieldKey returns the name clients know a field by: its key tag, for a field
+// which is read under a different name than it is written, or else its name
+// in the JSON encoding.
+func fieldKey(f reflect.StructField) string {
+	if key := f.Tag.Get("key"); key != "" {
+		return key
+	}
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
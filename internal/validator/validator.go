@@ -9,8 +9,28 @@ var (
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 )
 
+// CodeInvalid is the error code of errors added with Check and AddError.
+const CodeInvalid = "invalid"
+
+// FieldError is a single problem with a field. Code is a machine-readable
+// name for the problem, such as "required" or "max", which doesn't change
+// when the message is reworded or translated.
+type FieldError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+// Validator collects errors against keys, which name the fields of the
+// input. Keys of nested and repeated fields look like "genres[2]" or
+// "address.city".
+//
+// Errors holds the first message for each key, which is what most responses
+// show. Details holds every error, in the order they were found, so a field
+// can have more than one.
 type Validator struct {
-	Errors map[string]string
+	Errors  map[string]string
+	Details []FieldError
 }
 
 func New() *Validator {
@@ -22,11 +42,18 @@ func (v *Validator) Valid() bool {
 }
 
 // AddError adds an error message to the map as long
-// as not error already exists for the given key 
+// as not error already exists for the given key. Every
+// error is kept in Details, with the code CodeInvalid
 func (v *Validator) AddError(key, message string) {
+	v.AddErrorCode(key, CodeInvalid, message)
+}
+
+// AddErrorCode is like AddError, but records the error with a code.
+func (v *Validator) AddErrorCode(key, code, message string) {
 	if _, exists := v.Errors[key]; !exists {
 		v.Errors[key] = message
 	}
+	v.Details = append(v.Details, FieldError{Key: key, Code: code, Message: message})
 }
 
 // Check adds an error message to the map only if a
@@ -37,6 +64,24 @@ func (v *Validator) Check(ok bool, key, message string) {
 	}
 }
 
+// CheckCode is like Check, but records the error with a code.
+func (v *Validator) CheckCode(ok bool, key, code, message string) {
+	if !ok {
+		v.AddErrorCode(key, code, message)
+	}
+}
+
+// FieldErrors returns every error for key, in the order they were found.
+func (v *Validator) FieldErrors(key string) []FieldError {
+	var errs []FieldError
+	for _, e := range v.Details {
+		if e.Key == key {
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
 // returns true if a specific value is in a
 // list of strings
 func In(value string, list ...string) bool {
@@ -0,0 +1,150 @@
+package validator
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type testCast struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type testMovie struct {
+	Title   string     `json:"title" validate:"required,max=10"`
+	Year    int        `json:"year,omitempty" validate:"required,min=1888"`
+	Rating  string     `json:"rating" validate:"oneof=G PG R"`
+	Genres  []string   `json:"genres" validate:"required,min=1,max=3,unique,dive,required,max=5"`
+	Cast    []testCast `json:"cast"`
+	Contact *string    `json:"contact" validate:"email"`
+	Ignored string     `json:"-" validate:"-"`
+}
+
+func TestStruct(t *testing.T) {
+	v := New()
+	v.Struct(&testMovie{
+		Title:  "A title which is far too long",
+		Year:   1700,
+		Rating: "X",
+		Genres: []string{"drama", "", "drama", "romance"},
+		Cast:   []testCast{{Name: "Ann"}, {}},
+	})
+
+	want := []FieldError{
+		{"title", "max", "must not be more than 10 bytes long"},
+		{"year", "min", "must be at least 1888"},
+		{"rating", "oneof", "must be one of G, PG, R"},
+		{"genres", "max", "must not contain more than 3 items"},
+		{"genres", "unique", "must not contain duplicates"},
+		{"genres[1]", "required", "must be provided"},
+		{"genres[3]", "max", "must not be more than 5 bytes long"},
+		{"cast[1].name", "required", "must be provided"},
+	}
+	if !reflect.DeepEqual(v.Details, want) {
+		t.Errorf("got %+v;\nwant %+v", v.Details, want)
+	}
+
+	// Errors keeps the first message for each key.
+	if got := v.Errors["genres"]; got != "must not contain more than 3 items" {
+		t.Errorf("got %q for genres", got)
+	}
+	if got := len(v.FieldErrors("genres")); got != 2 {
+		t.Errorf("got %d errors for genres; want 2", got)
+	}
+}
+
+func TestStructMissing(t *testing.T) {
+	v := New()
+	v.Struct(testMovie{})
+
+	// Missing fields get only the required error, and fields which aren't
+	// required aren't checked at all.
+	for _, key := range []string{"title", "year", "genres"} {
+		errs := v.FieldErrors(key)
+		if len(errs) != 1 || errs[0].Code != "required" {
+			t.Errorf("got %+v for %s", errs, key)
+		}
+	}
+	if len(v.Details) != 3 {
+		t.Errorf("got %+v", v.Details)
+	}
+
+	contact := "not an address"
+	v = New()
+	v.Struct(testMovie{Title: "Up", Year: 2009, Genres: []string{"drama"}, Contact: &contact})
+	if errs := v.FieldErrors("contact"); len(errs) != 1 || errs[0].Code != "email" {
+		t.Errorf("got %+v", v.Details)
+	}
+}
+
+func TestVar(t *testing.T) {
+	v := New()
+	v.Var("password", "short", "required,min=8,max=72")
+	v.Var("tags", []string{"a", "b"}, "len=3")
+	v.Var("count", 0, "min=1")
+
+	want := map[string]string{
+		"password": "must be at least 8 bytes long",
+		"tags":     "must contain exactly 3 items",
+	}
+	if !reflect.DeepEqual(v.Errors, want) {
+		t.Errorf("got %v; want %v", v.Errors, want)
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	RegisterRule("even", "even", "must be even", func(value reflect.Value, _ string) bool {
+		return value.Int()%2 == 0
+	})
+	RegisterRule("prefix", "prefix", "must start with %s", func(value reflect.Value, param string) bool {
+		return strings.HasPrefix(value.String(), param)
+	})
+	RegisterPattern("slug", regexp.MustCompile(`^[a-z0-9-]+$`))
+
+	v := New()
+	v.Var("n", 3, "even")
+	v.Var("name", "bar", "prefix=foo")
+	v.Var("slug", "Not A Slug", "regex=slug")
+	v.Var("ok", "a-slug", "regex=slug")
+
+	want := []FieldError{
+		{"n", "even", "must be even"},
+		{"name", "prefix", "must start with foo"},
+		{"slug", "regex", "must be in a valid format"},
+	}
+	if !reflect.DeepEqual(v.Details, want) {
+		t.Errorf("got %+v;\nwant %+v", v.Details, want)
+	}
+}
+
+func TestUnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("an unknown rule didn't panic")
+		}
+	}()
+	New().Var("x", "y", "nonsense")
+}
+
+func TestCheck(t *testing.T) {
+	v := New()
+	v.Check(false, "email", "must be provided")
+	v.Check(false, "email", "must be a valid email address")
+	v.Check(true, "name", "must be provided")
+	v.CheckCode(false, "year", "future", "must not be in the future")
+
+	if v.Valid() {
+		t.Fatal("got a valid validator")
+	}
+	want := map[string]string{
+		"email": "must be provided",
+		"year":  "must not be in the future",
+	}
+	if !reflect.DeepEqual(v.Errors, want) {
+		t.Errorf("got %v; want %v", v.Errors, want)
+	}
+	if errs := v.FieldErrors("email"); len(errs) != 2 || errs[1].Code != CodeInvalid {
+		t.Errorf("got %+v", errs)
+	}
+}
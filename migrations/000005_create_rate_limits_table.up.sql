@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS rate_limits (
+			 key text PRIMARY KEY,
+			 tokens double precision NOT NULL,
+			 updated_at timestamp(6) with time zone NOT NULL DEFAULT clock_timestamp()
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS jobs (
+			 id bigserial PRIMARY KEY,
+			 kind text NOT NULL,
+			 payload jsonb NOT NULL,
+			 state text NOT NULL DEFAULT 'pending',
+			 attempts integer NOT NULL DEFAULT 0,
+			 max_attempts integer NOT NULL,
+			 run_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+			 locked_until timestamp(0) with time zone,
+			 last_error text NOT NULL DEFAULT '',
+			 created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+			 CONSTRAINT jobs_state_check CHECK (state IN ('pending', 'running', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS jobs_run_at_idx ON jobs (run_at) WHERE state IN ('pending', 'running');
@@ -0,0 +1,11 @@
+// Package migrations holds the SQL migration files for the greenlight
+// database, embedded in the binary so that the API can apply them itself.
+package migrations
+
+import "embed"
+
+// FS contains every *.up.sql and *.down.sql file in this directory. The file
+// names have the form <version>_<name>.<up|down>.sql.
+//
+//go:embed *.sql
+var FS embed.FS